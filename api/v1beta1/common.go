@@ -73,6 +73,11 @@ type NodeSection struct {
 	// +kubebuilder:validation:Optional
 	Networks []infranetworkv1.IPSetNetwork `json:"networks,omitempty"`
 
+	// DNSAliases - Additional hostnames of the node, added to its DNS records
+	// and to the TLS certs issued for it
+	// +kubebuilder:validation:Optional
+	DNSAliases []DNSAlias `json:"dnsAliases,omitempty"`
+
 	// UserData  node specific user-data
 	// +kubebuilder:validation:Optional
 	UserData *corev1.SecretReference `json:"userData,omitempty"`
@@ -96,6 +101,69 @@ type NodeSection struct {
 	// +kubebuilder:validation:Optional
 	// PreprovisioningNetworkDataName - NetworkData secret name in the local namespace for pre-provisioing
 	PreprovisioningNetworkDataName string `json:"preprovisioningNetworkDataName,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// CtlPlaneIP - Control plane IP of the node in CIDR notation, used to provision
+	// a baremetal node which gets no ctlplane IP from IPAM
+	CtlPlaneIP string `json:"ctlPlaneIP,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PreProvisioned - overrides the preProvisioned of the NodeSet for the node, so that
+	// pre-provisioned and baremetal provisioned nodes can be mixed in a NodeSet
+	PreProvisioned *bool `json:"preProvisioned,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=Removing
+	// State - set to Removing to exclude the node from the deployments of the NodeSet,
+	// run the removal services of the NodeSet on the node and release its resources
+	State string `json:"state,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	// ReplaceGeneration - increment to replace the hardware of the node, keeping its
+	// hostname, IPs and certs. The node is provisioned again on another BaremetalHost,
+	// and the replace services of the NodeSet are run on it.
+	ReplaceGeneration int64 `json:"replaceGeneration,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Labels - labels of the node, matched by the hostSelector of the services
+	// to only run them on some of the nodes of the NodeSet
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Baremetal - provisioning settings of a baremetal node, overriding its
+	// userData, networkData and preprovisioningNetworkDataName
+	Baremetal *BaremetalOverrides `json:"baremetal,omitempty"`
+}
+
+// BaremetalOverrides defines the per host provisioning settings of a baremetal node
+// supported by the OpenStackBaremetalSet
+type BaremetalOverrides struct {
+	// +kubebuilder:validation:Optional
+	// UserData - user-data of the host
+	UserData *corev1.SecretReference `json:"userData,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// NetworkData - network-data of the host
+	NetworkData *corev1.SecretReference `json:"networkData,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// PreprovisioningNetworkDataName - NetworkData secret name in the local namespace
+	// for pre-provisioning
+	PreprovisioningNetworkDataName string `json:"preprovisioningNetworkDataName,omitempty"`
+}
+
+// DNSAlias is an additional hostname of a node on one of its networks
+type DNSAlias struct {
+	// Name - alias of the node. A name without a domain is qualified with the
+	// dnsDomain of the network.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Network - name of the network whose address of the node the alias
+	// resolves to. Defaults to the ctlplane network.
+	// +kubebuilder:validation:Optional
+	Network infranetworkv1.NetNameStr `json:"network,omitempty"`
 }
 
 // NodeTemplate is a specification of the node attributes that override top level attributes.
@@ -155,8 +223,39 @@ type AnsibleEESpec struct {
 	AnsibleLimit string `json:"ansibleLimit,omitempty"`
 	// AnsibleSkipTags for ansible execution
 	AnsibleSkipTags string `json:"ansibleSkipTags,omitempty"`
+	// OverrideHosts the plays of the ansible execution target, instead of the NodeSet
+	// or all the NodeSets
+	OverrideHosts string `json:"overrideHosts,omitempty"`
 	// ServiceAccountName allows to specify what ServiceAccountName do we want
 	// the ansible execution run with. Without specifying, it will run with
 	// default serviceaccount
 	ServiceAccountName string
 }
+
+// RunnerPodTemplate defines the scheduling and resource settings of the ansible
+// execution pods
+type RunnerPodTemplate struct {
+	// Resources - compute resources requests and limits of the runner container
+	// +kubebuilder:validation:Optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty" yaml:"resources,omitempty"`
+
+	// NodeSelector - labels of the nodes the runner pods are scheduled on
+	// +kubebuilder:validation:Optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty"`
+
+	// Tolerations - tolerations of the runner pods
+	// +kubebuilder:validation:Optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty" yaml:"tolerations,omitempty"`
+
+	// Affinity - scheduling constraints of the runner pods
+	// +kubebuilder:validation:Optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty" yaml:"affinity,omitempty"`
+
+	// PriorityClassName - priority class of the runner pods
+	// +kubebuilder:validation:Optional
+	PriorityClassName string `json:"priorityClassName,omitempty" yaml:"priorityClassName,omitempty"`
+
+	// SecurityContext - pod level security attributes of the runner pods
+	// +kubebuilder:validation:Optional
+	SecurityContext *corev1.PodSecurityContext `json:"securityContext,omitempty" yaml:"securityContext,omitempty"`
+}
@@ -53,9 +53,25 @@ const (
 	// NodeSetBaremetalProvisionReadyWaitingMessage not yet ready
 	NodeSetBaremetalProvisionReadyWaitingMessage = "NodeSetBaremetalProvisionReady not yet ready"
 
+	// NodeSetBaremetalProvisionReadyHostsWaitingMessage not yet ready, with the progress of the hosts
+	NodeSetBaremetalProvisionReadyHostsWaitingMessage = "NodeSetBaremetalProvisionReady not yet ready, %d/%d hosts provisioned, waiting for %s"
+
 	// NodeSetBaremetalProvisionErrorMessage error
 	NodeSetBaremetalProvisionErrorMessage = "NodeSetBaremetalProvisionReady error occurred"
 
+	// NodeSetBaremetalProvisionHostsErrorMessage error, with the progress of the hosts
+	NodeSetBaremetalProvisionHostsErrorMessage = "NodeSetBaremetalProvisionReady error occurred, %d/%d hosts provisioned: %s"
+
+	// InsufficientBaremetalHostsReason reason of the NodeSetBaremetalProvisionReady
+	// condition when there are not enough available BaremetalHosts for the nodes
+	InsufficientBaremetalHostsReason condition.Reason = "InsufficientBaremetalHosts"
+
+	// NodeSetBaremetalProvisionInsufficientHostsMessage not enough available BaremetalHosts
+	NodeSetBaremetalProvisionInsufficientHostsMessage = "NodeSetBaremetalProvisionReady error occurred, %d nodes are waiting for a BaremetalHost: %s"
+
+	// NodeSetBaremetalProvisionCtlPlaneIPErrorMessage no ctlplane IP for nodes
+	NodeSetBaremetalProvisionCtlPlaneIPErrorMessage = "NodeSetBaremetalProvisionReady error occurred, no ctlplane IP for nodes %s, set a ctlplane network or a ctlPlaneIP"
+
 	// NodeSetIPReservationReadyCondition Status=True condition indicates
 	// IPSets reserved for all nodes in a NodeSet.
 	NodeSetIPReservationReadyCondition condition.Type = "NodeSetIPReservationReady"
@@ -85,6 +101,59 @@ const (
 	// NodeSetDNSDataMultipleDNSMasqErrorMessage error
 	NodeSetDNSDataMultipleDNSMasqErrorMessage = "NodeSet DNSData error occurred. Multiple DNSMasq resources exist."
 
+	// NodeSetTLSTransitionCondition Status=True condition indicates if the
+	// enablement of TLS on an already deployed NodeSet is finished.
+	NodeSetTLSTransitionCondition condition.Type = "TLSTransition"
+
+	// NodeSetTLSTransitionReadyMessage ready
+	NodeSetTLSTransitionReadyMessage = "TLS transition completed"
+
+	// NodeSetTLSTransitionPendingMessage pending
+	NodeSetTLSTransitionPendingMessage = "TLS transition pending, the next deployment will issue the certs and reconfigure the services"
+
+	// NodeSetTLSTransitionRunningMessage running
+	NodeSetTLSTransitionRunningMessage = "TLS transition in progress, %d of %d services reconfigured"
+
+	// NodeSetTeardownReadyCondition Status=True condition indicates if the
+	// teardown services of a deleted NodeSet are finished, so that the IPs,
+	// DNS records and baremetal hosts of the nodes can be released.
+	NodeSetTeardownReadyCondition condition.Type = "TeardownReady"
+
+	// NodeSetTeardownReadyMessage ready
+	NodeSetTeardownReadyMessage = "Teardown completed"
+
+	// NodeSetTeardownReadyRunningMessage running
+	NodeSetTeardownReadyRunningMessage = "Teardown in progress, running deployment %s"
+
+	// NodeSetTeardownReadyErrorMessage error
+	NodeSetTeardownReadyErrorMessage = "Teardown error occurred %s"
+
+	// NodeSetNodeRemovalReadyCondition Status=True condition indicates if the
+	// nodes in the Removing state are removed from the NodeSet.
+	NodeSetNodeRemovalReadyCondition condition.Type = "NodeRemovalReady"
+
+	// NodeSetNodeRemovalReadyMessage ready
+	NodeSetNodeRemovalReadyMessage = "Node removal completed"
+
+	// NodeSetNodeRemovalReadyRunningMessage running
+	NodeSetNodeRemovalReadyRunningMessage = "Node removal in progress for %s"
+
+	// NodeSetNodeRemovalReadyErrorMessage error
+	NodeSetNodeRemovalReadyErrorMessage = "Node removal error occurred %s"
+
+	// NodeSetNodeReplacementReadyCondition Status=True condition indicates if the
+	// nodes whose replaceGeneration changed are provisioned and deployed again.
+	NodeSetNodeReplacementReadyCondition condition.Type = "NodeReplacementReady"
+
+	// NodeSetNodeReplacementReadyMessage ready
+	NodeSetNodeReplacementReadyMessage = "Node replacement completed"
+
+	// NodeSetNodeReplacementReadyRunningMessage running
+	NodeSetNodeReplacementReadyRunningMessage = "Node replacement in progress for %s"
+
+	// NodeSetNodeReplacementReadyErrorMessage error
+	NodeSetNodeReplacementReadyErrorMessage = "Node replacement error occurred %s"
+
 	// InputReadyWaitingMessage not yet ready
 	InputReadyWaitingMessage = "Waiting for input %s, not yet ready"
 
@@ -109,4 +178,42 @@ const (
 
 	// NodeSetServiceDeploymentErrorMessage error
 	NodeSetServiceDeploymentErrorMessage = "Deployment error occurred in %s service"
+
+	// NodeSetServiceDeploymentTimeoutMessage timeout
+	NodeSetServiceDeploymentTimeoutMessage = "execution.name %s execution.namespace %s exceeded its active deadline of %ds"
+
+	// TimeoutReason reason of the service conditions, and of the conditions
+	// mirroring them, when an execution of a service exceeds its
+	// activeDeadlineSeconds
+	TimeoutReason condition.Reason = "Timeout"
+
+	// NodeSetServiceDeploymentSkippedMessage skipped
+	NodeSetServiceDeploymentSkippedMessage = "Deployment skipped for %s service, no node matches its hostSelector"
+
+	// SkippedReason reason of the service conditions when no node of the
+	// NodeSet matches the hostSelector of the service
+	SkippedReason condition.Reason = "Skipped"
+
+	// NodeSetServiceRunnerPodTemplateUnsupportedMessage error of the ansible
+	// executions with a runnerPodTemplate, until the OpenStackAnsibleEE API
+	// supports the runner pod settings
+	NodeSetServiceRunnerPodTemplateUnsupportedMessage = "runnerPodTemplate of %s service is unsupported by the OpenStackAnsibleEE API"
+
+	// NodeSetServiceHookReadyMessage ready
+	NodeSetServiceHookReadyMessage = "Deployment ready for %s hook %s of %s service"
+
+	// NodeSetServiceHookReadyWaitingMessage not yet ready
+	NodeSetServiceHookReadyWaitingMessage = "Deployment not yet ready for %s hook %s of %s service"
+
+	// NodeSetServiceHookErrorMessage error
+	NodeSetServiceHookErrorMessage = "Deployment error occurred in %s hook %s of %s service"
+
+	// NodeSetServiceHealthCheckReadyMessage ready
+	NodeSetServiceHealthCheckReadyMessage = "Health check passed for %s service"
+
+	// NodeSetServiceHealthCheckReadyWaitingMessage not yet ready
+	NodeSetServiceHealthCheckReadyWaitingMessage = "Health check not yet passed for %s service, attempt %d/%d"
+
+	// NodeSetServiceHealthCheckErrorMessage error
+	NodeSetServiceHealthCheckErrorMessage = "Health check failed for %s service"
 )
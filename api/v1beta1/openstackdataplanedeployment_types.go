@@ -35,6 +35,14 @@ type OpenStackDataPlaneDeploymentSpec struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:number"}
 	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
 
+	// ActiveDeadlineSeconds - seconds after which an execution of a service
+	// not finished yet is stopped and reported with the Timeout reason, for
+	// the services without an activeDeadlineSeconds of their own. Not set by
+	// default, the executions have no deadline.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum:=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
 	// AnsibleTags for ansible execution
 	// +kubebuilder:validation:Optional
 	AnsibleTags string `json:"ansibleTags,omitempty"`
@@ -57,6 +65,11 @@ type OpenStackDataPlaneDeploymentSpec struct {
 	// ServicesOverride list
 	ServicesOverride []string `json:"servicesOverride,omitempty"`
 
+	// HealthCheckOnly - only run the health checks of the services, to report
+	// the health of the NodeSets, without deploying the services
+	// +kubebuilder:validation:Optional
+	HealthCheckOnly bool `json:"healthCheckOnly,omitempty"`
+
 	// Time before the deployment is requeued in seconds
 	// +kubebuilder:validation:Minimum:=1
 	// +kubebuilder:default:=15
@@ -74,9 +87,16 @@ type OpenStackDataPlaneDeploymentStatus struct {
 	// SecretHashes
 	SecretHashes map[string]string `json:"secretHashes,omitempty" optional:"true"`
 
+	// AnsibleVarsHashes - the hashes of the inline ansibleVars of the services, keyed by service name
+	AnsibleVarsHashes map[string]string `json:"ansibleVarsHashes,omitempty" optional:"true"`
+
 	// NodeSetHashes
 	NodeSetHashes map[string]string `json:"nodeSetHashes,omitempty" optional:"true"`
 
+	// NodeSetTLSEnabled - whether TLS was enabled on each NodeSet when it was deployed.
+	// It isn't recorded by a deployment with ServicesOverride.
+	NodeSetTLSEnabled map[string]bool `json:"nodeSetTLSEnabled,omitempty" optional:"true"`
+
 	// ContainerImages
 	ContainerImages map[string]string `json:"containerImages,omitempty"`
 
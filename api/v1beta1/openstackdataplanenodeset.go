@@ -20,6 +20,14 @@ import (
 	"regexp"
 )
 
+const (
+	// NodeStateRemoving - state of a node being removed from its NodeSet
+	NodeStateRemoving = "Removing"
+
+	// DNSAliasDefaultNetwork - network of a DNS alias without network
+	DNSAliasDefaultNetwork = "ctlplane"
+)
+
 // NodeHostNameIsFQDN Helper to check if a hostname is fqdn
 func NodeHostNameIsFQDN(hostname string) bool {
 	// Regular expression to match a valid FQDN
@@ -18,8 +18,10 @@ package v1beta1
 
 import (
 	"fmt"
-
-	"golang.org/x/exp/slices"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
 
 	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	condition "github.com/openstack-k8s-operators/lib-common/modules/common/condition"
@@ -28,6 +30,7 @@ import (
 	openstackv1 "github.com/openstack-k8s-operators/openstack-operator/apis/core/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
@@ -58,11 +61,35 @@ type OpenStackDataPlaneNodeSetSpec struct {
 	// which allows to connect the ansibleee runner to the given network
 	NetworkAttachments []string `json:"networkAttachments,omitempty"`
 
+	// +kubebuilder:validation:Optional
+	// DNSMasqRef - name of the DNSMasq instance providing DNS for the nodes. When neither
+	// DNSMasqRef nor DNSMasqSelector is set, the only DNSMasq instance of the namespace is used.
+	DNSMasqRef string `json:"dnsMasqRef,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// DNSMasqSelector - labels of the DNSMasq instance providing DNS for the nodes
+	DNSMasqSelector map[string]string `json:"dnsMasqSelector,omitempty"`
+
 	// +kubebuilder:validation:Optional
 	// +kubebuilder:default={download-cache,bootstrap,configure-network,validate-network,install-os,configure-os,ssh-known-hosts,run-os,reboot-os,install-certs,ovn,neutron-metadata,libvirt,nova,telemetry}
 	// Services list
 	Services []string `json:"services"`
 
+	// +kubebuilder:validation:Optional
+	// Teardown - list of services run on the nodes when the NodeSet is deleted,
+	// before the IPs, DNS records and baremetal hosts of the nodes are released
+	Teardown []string `json:"teardown,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Removal - list of services run on the nodes in the Removing state, before the
+	// IPs, certs and baremetal hosts of the nodes are released
+	Removal []string `json:"removal,omitempty"`
+
+	// +kubebuilder:validation:Optional
+	// Replace - list of services run on a node whose hardware is replaced, once it
+	// is provisioned again. Defaults to the services of the NodeSet.
+	Replace []string `json:"replace,omitempty"`
+
 	// Tags - Additional tags for NodeSet
 	// +kubebuilder:validation:Optional
 	Tags []string `json:"tags,omitempty"`
@@ -84,6 +111,12 @@ type OpenStackDataPlaneNodeSetSpec struct {
 	// +kubebuilder:default=true
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,xDescriptors={"urn:alm:descriptor:com.tectonic.ui:booleanSwitch"}
 	TLSEnabled bool `json:"tlsEnabled" yaml:"tlsEnabled"`
+
+	// RunnerPodTemplate - scheduling and resource settings of the ansible
+	// execution pods of the NodeSet. Not supported by the OpenStackAnsibleEE
+	// API yet, the deployments of a NodeSet setting it fail.
+	// +kubebuilder:validation:Optional
+	RunnerPodTemplate *RunnerPodTemplate `json:"runnerPodTemplate,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -118,12 +151,21 @@ type OpenStackDataPlaneNodeSetStatus struct {
 	// AllIPs
 	AllIPs map[string]map[infranetworkv1.NetNameStr]string `json:"allIPs,omitempty" optional:"true"`
 
+	// AllAddresses - the addresses of every IP family of the nodes, keyed by host name and network
+	AllAddresses map[string]map[infranetworkv1.NetNameStr][]string `json:"allAddresses,omitempty" optional:"true"`
+
+	// DNSAliases - the fully qualified DNS aliases of the nodes, keyed by host name and network
+	DNSAliases map[string]map[infranetworkv1.NetNameStr][]string `json:"dnsAliases,omitempty" optional:"true"`
+
 	// ConfigMapHashes
 	ConfigMapHashes map[string]string `json:"configMapHashes,omitempty" optional:"true"`
 
 	// SecretHashes
 	SecretHashes map[string]string `json:"secretHashes,omitempty" optional:"true"`
 
+	// AnsibleVarsHashes - the hashes of the inline ansibleVars of the services, keyed by service name
+	AnsibleVarsHashes map[string]string `json:"ansibleVarsHashes,omitempty" optional:"true"`
+
 	// DNSClusterAddresses
 	DNSClusterAddresses []string `json:"dnsClusterAddresses,omitempty" optional:"true"`
 
@@ -149,6 +191,60 @@ type OpenStackDataPlaneNodeSetStatus struct {
 
 	// DeployedVersion
 	DeployedVersion string `json:"deployedVersion,omitempty"`
+
+	// DeployedTLSEnabled - whether TLS was enabled on the NodeSet when it was last deployed.
+	// This is used to determine when TLS is enabled on an already deployed NodeSet.
+	DeployedTLSEnabled *bool `json:"deployedTLSEnabled,omitempty"`
+
+	// ServiceCertSecrets - the secrets holding the TLS certs issued for the nodes,
+	// keyed by "<service>/<certkey>", along with the hosts included in each secret.
+	ServiceCertSecrets map[string][]ServiceCertSecret `json:"serviceCertSecrets,omitempty" optional:"true"`
+
+	// NodeReplacements - the replacements of the hardware of the nodes, keyed by node name
+	NodeReplacements map[string]NodeReplacementStatus `json:"nodeReplacements,omitempty" optional:"true"`
+
+	// BaremetalHosts - the provisioning progress of the baremetal nodes, keyed by host name
+	BaremetalHosts map[string]BaremetalHostStatus `json:"baremetalHosts,omitempty" optional:"true"`
+
+	// RemovedNodes - the nodes in the Removing state whose removal services are finished.
+	// Their IPs, DNS records and baremetal hosts are released, and they can be deleted from the nodes.
+	RemovedNodes []string `json:"removedNodes,omitempty" optional:"true"`
+}
+
+// ServiceCertSecret describes a secret holding the TLS certs of a set of hosts
+type ServiceCertSecret struct {
+	// Name - the name of the secret
+	Name string `json:"name"`
+
+	// Hosts - the hosts whose certs are held in the secret
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// NodeReplacementStatus describes the replacement of the hardware of a node
+type NodeReplacementStatus struct {
+	// Generation - the replaceGeneration of the node being replaced
+	Generation int64 `json:"generation"`
+
+	// ReplacedBMH - the BaremetalHost the node is moved away from
+	ReplacedBMH string `json:"replacedBMH,omitempty"`
+
+	// Released - whether the replaced BaremetalHost was released
+	Released bool `json:"released,omitempty"`
+
+	// Completed - whether the replace services were run on the node
+	Completed bool `json:"completed,omitempty"`
+}
+
+// BaremetalHostStatus describes the provisioning progress of a baremetal node
+type BaremetalHostStatus struct {
+	// BmhRef - the name of the BaremetalHost the node is provisioned on
+	BmhRef string `json:"bmhRef,omitempty"`
+
+	// ProvisioningState - the provisioning state of the BaremetalHost
+	ProvisioningState string `json:"provisioningState,omitempty"`
+
+	// ErrorMessage - the last error reported by the BaremetalHost
+	ErrorMessage string `json:"errorMessage,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -192,6 +288,74 @@ func (instance *OpenStackDataPlaneNodeSet) InitConditions() {
 	instance.Status.Conditions.Init(&cl)
 }
 
+// IsTLSTransitionPending - returns true when TLS has been enabled on a NodeSet
+// that was last deployed without TLS
+func (instance OpenStackDataPlaneNodeSet) IsTLSTransitionPending() bool {
+	if !instance.Spec.TLSEnabled || instance.Status.DeployedTLSEnabled == nil {
+		return false
+	}
+
+	return !*instance.Status.DeployedTLSEnabled
+}
+
+// IsNodePreProvisioned - returns true if a node of the NodeSet is pre-provisioned, from its
+// own preProvisioned or else from the one of the NodeSet
+func (spec *OpenStackDataPlaneNodeSetSpec) IsNodePreProvisioned(node NodeSection) bool {
+	if node.PreProvisioned != nil {
+		return *node.PreProvisioned
+	}
+	return spec.PreProvisioned
+}
+
+// GetNodeInstanceSpec - returns the provisioning settings of a baremetal node in the
+// BaremetalSet. The baremetal overrides of the node take precedence over its
+// userData, networkData and preprovisioningNetworkDataName.
+func (spec *OpenStackDataPlaneNodeSetSpec) GetNodeInstanceSpec(node NodeSection) baremetalv1.InstanceSpec {
+	instanceSpec := baremetalv1.InstanceSpec{
+		CtlPlaneIP:                     node.CtlPlaneIP,
+		UserData:                       node.UserData,
+		NetworkData:                    node.NetworkData,
+		PreprovisioningNetworkDataName: node.PreprovisioningNetworkDataName,
+	}
+	if node.Baremetal == nil {
+		return instanceSpec
+	}
+	if node.Baremetal.UserData != nil {
+		instanceSpec.UserData = node.Baremetal.UserData
+	}
+	if node.Baremetal.NetworkData != nil {
+		instanceSpec.NetworkData = node.Baremetal.NetworkData
+	}
+	if node.Baremetal.PreprovisioningNetworkDataName != "" {
+		instanceSpec.PreprovisioningNetworkDataName = node.Baremetal.PreprovisioningNetworkDataName
+	}
+	return instanceSpec
+}
+
+// HasBaremetalNodes - returns true if some nodes of the NodeSet are provisioned through
+// a BaremetalSet
+func (spec *OpenStackDataPlaneNodeSetSpec) HasBaremetalNodes() bool {
+	if !spec.PreProvisioned {
+		return true
+	}
+	for _, node := range spec.Nodes {
+		if !spec.IsNodePreProvisioned(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPreProvisionedNodes - returns true if some nodes of the NodeSet are pre-provisioned
+func (spec *OpenStackDataPlaneNodeSetSpec) HasPreProvisionedNodes() bool {
+	for _, node := range spec.Nodes {
+		if spec.IsNodePreProvisioned(node) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAnsibleEESpec - get the fields that will be passed to AEE
 func (instance OpenStackDataPlaneNodeSet) GetAnsibleEESpec() AnsibleEESpec {
 	return AnsibleEESpec{
@@ -267,26 +431,347 @@ func getStrPtr(in string) *string {
 }
 
 // duplicateNodeCheck checks the NodeSetList for pre-existing nodes. If the user is trying to redefine an
-// existing node, we will return an error and block resource creation.
-func (r *OpenStackDataPlaneNodeSetSpec) duplicateNodeCheck(nodeSetList *OpenStackDataPlaneNodeSetList) (errors field.ErrorList) {
-	existingNodeNames := make([]string, 0)
-	for _, existingNode := range nodeSetList.Items {
-		for _, node := range existingNode.Spec.Nodes {
-			existingNodeNames = append(existingNodeNames, node.HostName)
-			if node.Ansible.AnsibleHost != "" {
-				existingNodeNames = append(existingNodeNames, node.Ansible.AnsibleHost)
+// existing node, by its name, hostName or ansibleHost, we will return an error and block the resource
+// creation or update. The nodes of the NodeSet are checked against each other as well.
+func (r *OpenStackDataPlaneNodeSetSpec) duplicateNodeCheck(nodeSetList *OpenStackDataPlaneNodeSetList, unchanged map[string]bool) (errors field.ErrorList) {
+	existingNodeNames := make(map[string]string)
+	for _, existingNodeSet := range nodeSetList.Items {
+		for nodeName, node := range existingNodeSet.Spec.Nodes {
+			for _, name := range []string{nodeName, node.HostName, node.Ansible.AnsibleHost} {
+				if name != "" {
+					existingNodeNames[name] = existingNodeSet.Name
+				}
+			}
+		}
+	}
+
+	nodeNames := r.sortedNodeNames(unchanged)
+
+	nodeSetNodeNames := make(map[string]string)
+	for _, nodeName := range nodeNames {
+		node := r.Nodes[nodeName]
+		for _, name := range []string{nodeName, node.HostName, node.Ansible.AnsibleHost} {
+			if name == "" {
+				continue
+			}
+			if nodeSetName, ok := existingNodeNames[name]; ok {
+				errors = append(errors, field.Invalid(
+					field.NewPath("spec").Child("nodes").Key(nodeName),
+					name,
+					fmt.Sprintf("node %s already exists in another cluster, in NodeSet %s", name, nodeSetName)))
+				break
+			}
+			if otherNodeName, ok := nodeSetNodeNames[name]; ok && otherNodeName != nodeName {
+				errors = append(errors, field.Invalid(
+					field.NewPath("spec").Child("nodes").Key(nodeName),
+					name,
+					fmt.Sprintf("node %s is already defined by node %s of the NodeSet", name, otherNodeName)))
+				break
+			}
+			nodeSetNodeNames[name] = nodeName
+		}
+	}
+
+	return
+}
+
+// sortedNodeNames returns the names of the nodes of the NodeSet, sorted. The unchanged
+// nodes are listed first, so that a conflict between two nodes of the NodeSet is reported
+// on the node which is new or changed.
+func (r *OpenStackDataPlaneNodeSetSpec) sortedNodeNames(unchanged map[string]bool) []string {
+	nodeNames := make([]string, 0, len(r.Nodes))
+	for nodeName := range r.Nodes {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	sort.Slice(nodeNames, func(i, j int) bool {
+		if unchanged[nodeNames[i]] != unchanged[nodeNames[j]] {
+			return unchanged[nodeNames[i]]
+		}
+		return nodeNames[i] < nodeNames[j]
+	})
+	return nodeNames
+}
+
+// unchangedNodes returns the nodes of the NodeSet which are unchanged compared with an
+// older version of the spec, along with the nodeTemplate networks and the ctlplaneGateway
+// they depend on
+func (r *OpenStackDataPlaneNodeSetSpec) unchangedNodes(oldSpec *OpenStackDataPlaneNodeSetSpec) map[string]bool {
+	templateNetworksChanged := !reflect.DeepEqual(r.NodeTemplate.Networks, oldSpec.NodeTemplate.Networks)
+	gatewayChanged := r.BaremetalSetTemplate.CtlplaneGateway != oldSpec.BaremetalSetTemplate.CtlplaneGateway
+
+	unchanged := make(map[string]bool)
+	for nodeName, node := range r.Nodes {
+		oldNode, ok := oldSpec.Nodes[nodeName]
+		if !ok || !reflect.DeepEqual(node, oldNode) {
+			continue
+		}
+		if (len(node.Networks) == 0 && templateNetworksChanged) || (node.CtlPlaneIP != "" && gatewayChanged) {
+			continue
+		}
+		unchanged[nodeName] = true
+	}
+
+	return unchanged
+}
+
+// changedFieldErrors returns the errors on the fields which are new or changed compared
+// with an older version of the spec, given its unchanged nodes
+func (r *OpenStackDataPlaneNodeSetSpec) changedFieldErrors(errors field.ErrorList,
+	oldSpec *OpenStackDataPlaneNodeSetSpec, unchanged map[string]bool,
+) field.ErrorList {
+	// The errors on the nodeTemplate networks concern the nodes inheriting them
+	templateChanged := !reflect.DeepEqual(r.NodeTemplate, oldSpec.NodeTemplate)
+	for nodeName, node := range r.Nodes {
+		if len(node.Networks) == 0 && !unchanged[nodeName] {
+			templateChanged = true
+		}
+	}
+
+	var changedErrors field.ErrorList
+	for _, err := range errors {
+		switch {
+		case strings.HasPrefix(err.Field, "spec.nodes["):
+			nodeName, _, _ := strings.Cut(strings.TrimPrefix(err.Field, "spec.nodes["), "]")
+			if unchanged[nodeName] {
+				continue
+			}
+		case strings.HasPrefix(err.Field, "spec.nodeTemplate."):
+			if !templateChanged {
+				continue
+			}
+		case strings.HasPrefix(err.Field, "spec.baremetalSetTemplate."):
+			if reflect.DeepEqual(r.BaremetalSetTemplate, oldSpec.BaremetalSetTemplate) {
+				continue
+			}
+		}
+		changedErrors = append(changedErrors, err)
+	}
+
+	return changedErrors
+}
+
+// nodeNetworks returns the networks of a node and their field path, which are
+// inherited from the nodeTemplate when the node does not define any
+func (r *OpenStackDataPlaneNodeSetSpec) nodeNetworks(nodeName string) ([]infranetworkv1.IPSetNetwork, *field.Path) {
+	if nets := r.Nodes[nodeName].Networks; len(nets) > 0 {
+		return nets, field.NewPath("spec").Child("nodes").Key(nodeName).Child("networks")
+	}
+	return r.NodeTemplate.Networks, field.NewPath("spec").Child("nodeTemplate").Child("networks")
+}
+
+// duplicateFixedIPCheck checks that the fixed IPs of the nodes do not collide on a network,
+// neither between the nodes of the NodeSet nor with the nodes of the NodeSetList.
+func (r *OpenStackDataPlaneNodeSetSpec) duplicateFixedIPCheck(nodeSetList *OpenStackDataPlaneNodeSetList, unchanged map[string]bool) (errors field.ErrorList) {
+	// fixed IPs by network, mapped to the node holding them
+	existingFixedIPs := make(map[string]string)
+	for _, existingNodeSet := range nodeSetList.Items {
+		for nodeName := range existingNodeSet.Spec.Nodes {
+			nets, _ := existingNodeSet.Spec.nodeNetworks(nodeName)
+			for _, network := range nets {
+				if network.FixedIP == nil {
+					continue
+				}
+				ip := net.ParseIP(*network.FixedIP)
+				if ip == nil {
+					continue
+				}
+				key := fmt.Sprintf("%s/%s", strings.ToLower(string(network.Name)), ip.String())
+				existingFixedIPs[key] = fmt.Sprintf("node %s of NodeSet %s", nodeName, existingNodeSet.Name)
+			}
+		}
+	}
+
+	nodeNames := r.sortedNodeNames(unchanged)
+
+	reported := make(map[string]bool)
+	for _, nodeName := range nodeNames {
+		nets, path := r.nodeNetworks(nodeName)
+		for i, network := range nets {
+			if network.FixedIP == nil {
+				continue
+			}
+			fixedIPPath := path.Index(i).Child("fixedIP")
+			ip := net.ParseIP(*network.FixedIP)
+			if ip == nil {
+				if !reported[fixedIPPath.String()] {
+					reported[fixedIPPath.String()] = true
+					errors = append(errors, field.Invalid(fixedIPPath, *network.FixedIP,
+						"fixedIP is not a valid IP address"))
+				}
+				continue
+			}
+			key := fmt.Sprintf("%s/%s", strings.ToLower(string(network.Name)), ip.String())
+			if owner, ok := existingFixedIPs[key]; ok && !reported[fixedIPPath.String()] {
+				reported[fixedIPPath.String()] = true
+				errors = append(errors, field.Invalid(fixedIPPath, *network.FixedIP,
+					fmt.Sprintf("fixedIP %s of node %s on network %s is already used by %s",
+						*network.FixedIP, nodeName, network.Name, owner)))
+				continue
+			}
+			existingFixedIPs[key] = fmt.Sprintf("node %s of the NodeSet", nodeName)
+		}
+	}
+
+	return
+}
+
+// dnsAliasCheck checks that the DNS aliases of the nodes are valid DNS names, on one of the
+// networks of their node, and that no alias is defined twice on a network of the NodeSet.
+func (r *OpenStackDataPlaneNodeSetSpec) dnsAliasCheck(unchanged map[string]bool) (errors field.ErrorList) {
+	nodeNames := r.sortedNodeNames(unchanged)
+
+	// aliases by network, mapped to the node holding them
+	aliases := make(map[string]string)
+	for _, nodeName := range nodeNames {
+		nets, _ := r.nodeNetworks(nodeName)
+		for i, alias := range r.Nodes[nodeName].DNSAliases {
+			aliasPath := field.NewPath("spec").Child("nodes").Key(nodeName).Child("dnsAliases").Index(i)
+			for _, msg := range validation.IsDNS1123Subdomain(strings.ToLower(alias.Name)) {
+				errors = append(errors, field.Invalid(aliasPath.Child("name"), alias.Name, msg))
+			}
+			network := strings.ToLower(string(alias.Network))
+			if network == "" {
+				network = DNSAliasDefaultNetwork
+			}
+			found := false
+			for _, nodeNetwork := range nets {
+				if strings.EqualFold(string(nodeNetwork.Name), network) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				errors = append(errors, field.Invalid(aliasPath.Child("network"), alias.Network,
+					fmt.Sprintf("node %s has no address on network %s", nodeName, network)))
+				continue
 			}
+			key := fmt.Sprintf("%s/%s", network, strings.ToLower(alias.Name))
+			if owner, ok := aliases[key]; ok {
+				errors = append(errors, field.Invalid(aliasPath.Child("name"), alias.Name,
+					fmt.Sprintf("DNS alias %s on network %s is already used by node %s", alias.Name, network, owner)))
+				continue
+			}
+			aliases[key] = nodeName
 		}
 	}
 
-	for _, newNodeName := range r.Nodes {
-		if slices.Contains(existingNodeNames, newNodeName.HostName) || slices.Contains(existingNodeNames, newNodeName.Ansible.AnsibleHost) {
-			errors = append(errors, field.Invalid(
-				field.NewPath("spec").Child("nodes"),
-				newNodeName,
-				fmt.Sprintf("node %s already exists in another cluster", newNodeName.HostName)))
+	return
+}
+
+// ctlPlaneIPCheck checks the explicit ctlplane addresses used to provision the baremetal nodes
+// without IPAM: the ctlPlaneIP of the nodes must be in CIDR notation, the ctlplaneGateway of the
+// baremetalSetTemplate must be within their CIDR, and its bootstrapDns must be IP addresses.
+func (r *OpenStackDataPlaneNodeSetSpec) ctlPlaneIPCheck() (errors field.ErrorList) {
+	templatePath := field.NewPath("spec").Child("baremetalSetTemplate")
+	gateway := r.BaremetalSetTemplate.CtlplaneGateway
+	gatewayIP := net.ParseIP(gateway)
+	if gateway != "" && gatewayIP == nil {
+		errors = append(errors, field.Invalid(templatePath.Child("ctlplaneGateway"), gateway,
+			"ctlplaneGateway is not a valid IP address"))
+	}
+	for i, dns := range r.BaremetalSetTemplate.BootstrapDNS {
+		if net.ParseIP(dns) == nil {
+			errors = append(errors, field.Invalid(templatePath.Child("bootstrapDns").Index(i), dns,
+				"bootstrapDns is not a valid IP address"))
+		}
+	}
+
+	nodeNames := r.sortedNodeNames(nil)
+
+	for _, nodeName := range nodeNames {
+		ctlPlaneIP := r.Nodes[nodeName].CtlPlaneIP
+		if ctlPlaneIP == "" {
+			continue
+		}
+		ctlPlaneIPPath := field.NewPath("spec").Child("nodes").Key(nodeName).Child("ctlPlaneIP")
+		_, cidr, err := net.ParseCIDR(ctlPlaneIP)
+		if err != nil {
+			errors = append(errors, field.Invalid(ctlPlaneIPPath, ctlPlaneIP,
+				"ctlPlaneIP is not an IP address in CIDR notation"))
+			continue
+		}
+		if gatewayIP != nil && !cidr.Contains(gatewayIP) {
+			errors = append(errors, field.Invalid(ctlPlaneIPPath, ctlPlaneIP,
+				fmt.Sprintf("ctlplaneGateway %s is outside of the ctlPlaneIP %s of node %s",
+					gateway, ctlPlaneIP, nodeName)))
 		}
 	}
 
 	return
 }
+
+// baremetalOverridesCheck checks that the baremetal overrides are only set on the
+// baremetal nodes
+func (r *OpenStackDataPlaneNodeSetSpec) baremetalOverridesCheck() (errors field.ErrorList) {
+	for _, nodeName := range r.sortedNodeNames(nil) {
+		node := r.Nodes[nodeName]
+		if node.Baremetal != nil && r.IsNodePreProvisioned(node) {
+			errors = append(errors, field.Forbidden(
+				field.NewPath("spec").Child("nodes").Key(nodeName).Child("baremetal"),
+				fmt.Sprintf("baremetal can't be set on the pre-provisioned node %s", nodeName)))
+		}
+	}
+
+	return
+}
+
+// fixedIPRangeCheck checks that the fixed IPs of the nodes are within the CIDR of their subnet
+// in the NetConfig. The check is skipped when no NetConfig exists yet.
+func (r *OpenStackDataPlaneNodeSetSpec) fixedIPRangeCheck(netConfigList *infranetworkv1.NetConfigList) (errors field.ErrorList) {
+	if len(netConfigList.Items) == 0 {
+		return
+	}
+
+	nodeNames := r.sortedNodeNames(nil)
+
+	reported := make(map[string]bool)
+	for _, nodeName := range nodeNames {
+		nets, path := r.nodeNetworks(nodeName)
+		for i, network := range nets {
+			fixedIPPath := path.Index(i).Child("fixedIP")
+			if network.FixedIP == nil || reported[fixedIPPath.String()] {
+				continue
+			}
+			ip := net.ParseIP(*network.FixedIP)
+			if ip == nil {
+				// reported by duplicateFixedIPCheck
+				continue
+			}
+			subnet := getNetConfigSubnet(netConfigList, network)
+			if subnet == nil {
+				reported[fixedIPPath.String()] = true
+				errors = append(errors, field.Invalid(fixedIPPath, *network.FixedIP,
+					fmt.Sprintf("subnet %s of network %s is not defined in the NetConfig",
+						network.SubnetName, network.Name)))
+				continue
+			}
+			_, cidr, err := net.ParseCIDR(subnet.Cidr)
+			if err != nil || !cidr.Contains(ip) {
+				reported[fixedIPPath.String()] = true
+				errors = append(errors, field.Invalid(fixedIPPath, *network.FixedIP,
+					fmt.Sprintf("fixedIP %s of node %s is outside of the %s CIDR of subnet %s of network %s",
+						*network.FixedIP, nodeName, subnet.Cidr, network.SubnetName, network.Name)))
+			}
+		}
+	}
+
+	return
+}
+
+// getNetConfigSubnet returns the subnet of the NetConfig requested by an IPSet network
+func getNetConfigSubnet(netConfigList *infranetworkv1.NetConfigList, network infranetworkv1.IPSetNetwork) *infranetworkv1.Subnet {
+	for _, netConfig := range netConfigList.Items {
+		for _, netConfigNetwork := range netConfig.Spec.Networks {
+			if !strings.EqualFold(string(netConfigNetwork.Name), string(network.Name)) {
+				continue
+			}
+			for i, subnet := range netConfigNetwork.Subnets {
+				if strings.EqualFold(string(subnet.Name), string(network.SubnetName)) {
+					return &netConfigNetwork.Subnets[i]
+				}
+			}
+		}
+	}
+
+	return nil
+}
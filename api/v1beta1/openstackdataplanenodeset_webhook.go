@@ -23,8 +23,10 @@ import (
 	"strings"
 
 	"github.com/go-playground/validator/v10"
+	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
 	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -73,7 +75,7 @@ func (spec *OpenStackDataPlaneNodeSetSpec) Default() {
 		if node.HostName == "" {
 			node.HostName = nodeName
 		}
-		if !spec.PreProvisioned {
+		if !spec.IsNodePreProvisioned(node) {
 			if !NodeHostNameIsFQDN(node.HostName) && domain != "" {
 				node.HostName = strings.Join([]string{nodeName, domain}, ".")
 			}
@@ -81,18 +83,31 @@ func (spec *OpenStackDataPlaneNodeSetSpec) Default() {
 		spec.Nodes[nodeName] = *node.DeepCopy()
 	}
 
-	if !spec.PreProvisioned {
-		spec.NodeTemplate.Ansible.AnsibleUser = spec.BaremetalSetTemplate.CloudUserName
+	if spec.HasBaremetalNodes() {
+		// The cloud user of the BaremetalSet is only set on the baremetal nodes, and
+		// the nodeTemplate is left to the pre-provisioned nodes
+		if spec.HasPreProvisionedNodes() {
+			for nodeName, node := range spec.Nodes {
+				if !spec.IsNodePreProvisioned(node) {
+					node.Ansible.AnsibleUser = spec.BaremetalSetTemplate.CloudUserName
+					spec.Nodes[nodeName] = node
+				}
+			}
+			if spec.NodeTemplate.Ansible.AnsibleUser == "" {
+				spec.NodeTemplate.Ansible.AnsibleUser = "cloud-admin"
+			}
+		} else {
+			spec.NodeTemplate.Ansible.AnsibleUser = spec.BaremetalSetTemplate.CloudUserName
+		}
 		if spec.BaremetalSetTemplate.DeploymentSSHSecret == "" {
 			spec.BaremetalSetTemplate.DeploymentSSHSecret = spec.NodeTemplate.AnsibleSSHPrivateKeySecret
 		}
 		nodeSetHostMap := make(map[string]baremetalv1.InstanceSpec)
 		for _, node := range spec.Nodes {
-			instanceSpec := baremetalv1.InstanceSpec{}
-			instanceSpec.UserData = node.UserData
-			instanceSpec.NetworkData = node.NetworkData
-			instanceSpec.PreprovisioningNetworkDataName = node.PreprovisioningNetworkDataName
-			nodeSetHostMap[node.HostName] = instanceSpec
+			if spec.IsNodePreProvisioned(node) {
+				continue
+			}
+			nodeSetHostMap[node.HostName] = spec.GetNodeInstanceSpec(node)
 		}
 		spec.BaremetalSetTemplate.BaremetalHosts = nodeSetHostMap
 	} else if spec.NodeTemplate.Ansible.AnsibleUser == "" {
@@ -111,12 +126,7 @@ func (r *OpenStackDataPlaneNodeSet) ValidateCreate() (admission.Warnings, error)
 
 	var errors field.ErrorList
 
-	nodeSetList := &OpenStackDataPlaneNodeSetList{}
-	opts := &client.ListOptions{
-		Namespace: r.ObjectMeta.Namespace,
-	}
-
-	err := webhookClient.List(context.TODO(), nodeSetList, opts)
+	nodeSetList, netConfigList, err := r.listNodeSetsAndNetConfigs()
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +141,7 @@ func (r *OpenStackDataPlaneNodeSet) ValidateCreate() (admission.Warnings, error)
 	}
 
 	errors = append(errors, r.Spec.ValidateCreate(nodeSetList)...)
+	errors = append(errors, r.Spec.fixedIPRangeCheck(netConfigList)...)
 
 	if len(errors) > 0 {
 		openstackdataplanenodesetlog.Info("validation failed", "name", r.Name)
@@ -144,17 +155,56 @@ func (r *OpenStackDataPlaneNodeSet) ValidateCreate() (admission.Warnings, error)
 }
 
 func (r *OpenStackDataPlaneNodeSetSpec) ValidateCreate(nodeSetList *OpenStackDataPlaneNodeSetList) field.ErrorList {
+	return r.ValidateNodes(nodeSetList)
+}
+
+// ValidateNodes checks that the nodes of the NodeSet, and their fixed IPs, are not already
+// defined by another node of the NodeSet or by the nodes of the other NodeSets, and that
+// the DNS aliases and the explicit ctlplane addresses of the nodes are valid
+func (r *OpenStackDataPlaneNodeSetSpec) ValidateNodes(nodeSetList *OpenStackDataPlaneNodeSetList) field.ErrorList {
+	return r.validateNodes(nodeSetList, nil)
+}
+
+// validateNodes runs the checks of ValidateNodes, reporting the conflicts between the
+// nodes of the NodeSet on the nodes which are not unchanged
+func (r *OpenStackDataPlaneNodeSetSpec) validateNodes(nodeSetList *OpenStackDataPlaneNodeSetList, unchanged map[string]bool) field.ErrorList {
 	var errors field.ErrorList
-	// Currently, this check is only valid for PreProvisioned nodes. Since we can't possibly
-	// have duplicates in Baremetal Deployments, we can exit early here for Baremetal NodeSets.
-	// If this is the first NodeSet being created, then there can be no duplicates
-	// we can exit early here.
-	if r.PreProvisioned && len(nodeSetList.Items) != 0 {
-		errors = append(errors, r.duplicateNodeCheck(nodeSetList)...)
-	}
+	errors = append(errors, r.duplicateNodeCheck(nodeSetList, unchanged)...)
+	errors = append(errors, r.duplicateFixedIPCheck(nodeSetList, unchanged)...)
+	errors = append(errors, r.dnsAliasCheck(unchanged)...)
+	errors = append(errors, r.ctlPlaneIPCheck()...)
+	errors = append(errors, r.baremetalOverridesCheck()...)
 
 	return errors
+}
+
+// listNodeSetsAndNetConfigs returns the other NodeSets and the NetConfigs of the
+// namespace of the NodeSet
+func (r *OpenStackDataPlaneNodeSet) listNodeSetsAndNetConfigs() (*OpenStackDataPlaneNodeSetList, *infranetworkv1.NetConfigList, error) {
+	opts := &client.ListOptions{
+		Namespace: r.ObjectMeta.Namespace,
+	}
 
+	nodeSetList := &OpenStackDataPlaneNodeSetList{}
+	err := webhookClient.List(context.TODO(), nodeSetList, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	otherNodeSets := nodeSetList.Items[:0]
+	for _, nodeSet := range nodeSetList.Items {
+		if nodeSet.Name != r.Name {
+			otherNodeSets = append(otherNodeSets, nodeSet)
+		}
+	}
+	nodeSetList.Items = otherNodeSets
+
+	netConfigList := &infranetworkv1.NetConfigList{}
+	err = webhookClient.List(context.TODO(), netConfigList, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nodeSetList, netConfigList, nil
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
@@ -166,8 +216,29 @@ func (r *OpenStackDataPlaneNodeSet) ValidateUpdate(old runtime.Object) (admissio
 			fmt.Errorf("expected a OpenStackDataPlaneNodeSet object, but got %T", oldNodeSet))
 	}
 
+	// Metadata only updates, like the finalizers added and removed by the
+	// controller, are not validated
+	if equality.Semantic.DeepEqual(r.Spec, oldNodeSet.Spec) {
+		return nil, nil
+	}
+
 	errors := r.Spec.ValidateUpdate(&oldNodeSet.Spec)
 
+	// Only the new or changed nodes are validated, so that the nodes already
+	// accepted are not rejected because of a later change of another NodeSet or
+	// of the NetConfig. The nodes are not validated while the NodeSet is being
+	// deleted.
+	if r.DeletionTimestamp.IsZero() {
+		nodeSetList, netConfigList, err := r.listNodeSetsAndNetConfigs()
+		if err != nil {
+			return nil, err
+		}
+		unchanged := r.Spec.unchangedNodes(&oldNodeSet.Spec)
+		nodeErrors := r.Spec.validateNodes(nodeSetList, unchanged)
+		nodeErrors = append(nodeErrors, r.Spec.fixedIPRangeCheck(netConfigList)...)
+		errors = append(errors, r.Spec.changedFieldErrors(nodeErrors, &oldNodeSet.Spec, unchanged)...)
+	}
+
 	if errors != nil {
 		openstackdataplanenodesetlog.Info("validation failed", "name", r.Name)
 		return nil, apierrors.NewInvalid(
@@ -177,7 +248,9 @@ func (r *OpenStackDataPlaneNodeSet) ValidateUpdate(old runtime.Object) (admissio
 		)
 
 	}
-	if oldNodeSet.Status.DeploymentStatuses != nil {
+	// The deployments no longer block a NodeSet being deleted, which runs its
+	// own teardown deployment
+	if oldNodeSet.Status.DeploymentStatuses != nil && r.DeletionTimestamp.IsZero() {
 		for deployName, deployConditions := range oldNodeSet.Status.DeploymentStatuses {
 			deployCondition := deployConditions.Get(NodeSetDeploymentReadyCondition)
 			if !deployConditions.IsTrue(NodeSetDeploymentReadyCondition) && !condition.IsError(deployCondition) {
@@ -191,7 +264,17 @@ func (r *OpenStackDataPlaneNodeSet) ValidateUpdate(old runtime.Object) (admissio
 		}
 	}
 
-	return nil, nil
+	var warnings admission.Warnings
+	if r.Spec.TLSEnabled && !oldNodeSet.Spec.TLSEnabled &&
+		oldNodeSet.Status.DeployedTLSEnabled != nil && !*oldNodeSet.Status.DeployedTLSEnabled {
+		warnings = append(warnings, fmt.Sprintf(
+			"TLS has been enabled on the already deployed OpenStackDataPlaneNodeSet %s. "+
+				"The next OpenStackDataPlaneDeployment will issue the certs, run the install-certs service "+
+				"and reconfigure the TLS consuming services before deploying any other service",
+			r.Name))
+	}
+
+	return warnings, nil
 }
 
 func (r *OpenStackDataPlaneNodeSetSpec) ValidateUpdate(oldSpec *OpenStackDataPlaneNodeSetSpec) field.ErrorList {
@@ -213,6 +296,37 @@ func (r *OpenStackDataPlaneNodeSetSpec) ValidateUpdate(oldSpec *OpenStackDataPla
 		}
 	}
 
+	for nodeName, node := range r.Nodes {
+		oldNode, ok := oldSpec.Nodes[nodeName]
+		if !ok {
+			continue
+		}
+		// A replacement of the hardware of a node is requested by incrementing its
+		// replaceGeneration, which can't go back to a previous replacement
+		if node.ReplaceGeneration < oldNode.ReplaceGeneration {
+			errors = append(errors, field.Invalid(
+				field.NewPath("spec.nodes").Key(nodeName).Child("replaceGeneration"),
+				node.ReplaceGeneration,
+				fmt.Sprintf("replaceGeneration can't be decreased from %d", oldNode.ReplaceGeneration)))
+		}
+		// Switching a node between pre-provisioned and baremetal provisioned would
+		// provision, or de-provision, the host of a deployed node. The node has to
+		// be removed and added again instead.
+		if r.IsNodePreProvisioned(node) != oldSpec.IsNodePreProvisioned(oldNode) {
+			errors = append(errors, field.Forbidden(
+				field.NewPath("spec.nodes").Key(nodeName).Child("preProvisioned"),
+				"preProvisioned of an existing node can't be changed, remove the node and add it again instead"))
+		}
+		// The baremetal overrides of a node only apply when its host is
+		// provisioned, they can only change along with a replacement of the node
+		if !equality.Semantic.DeepEqual(node.Baremetal, oldNode.Baremetal) &&
+			node.ReplaceGeneration == oldNode.ReplaceGeneration {
+			errors = append(errors, field.Forbidden(
+				field.NewPath("spec.nodes").Key(nodeName).Child("baremetal"),
+				"baremetal of an existing node can only be changed along with an increment of its replaceGeneration"))
+		}
+	}
+
 	return errors
 }
 
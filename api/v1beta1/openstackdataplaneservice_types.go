@@ -17,6 +17,9 @@ limitations under the License.
 package v1beta1
 
 import (
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	certmgrv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
@@ -24,6 +27,26 @@ import (
 	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
 )
 
+const (
+	// ServiceHookRunOnNodes - the hook runs on the nodes targeted by the service
+	ServiceHookRunOnNodes = "nodes"
+
+	// ServiceHookRunOnRunner - the hook runs on the ansible runner
+	ServiceHookRunOnRunner = "runner"
+
+	// ServiceManagedAnnotation - set to "false" on a default service so that its
+	// spec is no longer updated by the operator
+	ServiceManagedAnnotation = "dataplane.openstack.org/managed"
+
+	// ServiceLastAppliedDefaultAnnotation - the default spec last applied by the
+	// operator to a default service
+	ServiceLastAppliedDefaultAnnotation = "dataplane.openstack.org/last-applied-default"
+
+	// ServiceCatalogVersionAnnotation - the version of the catalog of default
+	// services the operator last applied to a default service
+	ServiceCatalogVersionAnnotation = "dataplane.openstack.org/service-catalog-version"
+)
+
 // OpenstackDataPlaneServiceCert defines the property of a TLS cert issued for
 // a dataplane service
 type OpenstackDataPlaneServiceCert struct {
@@ -56,6 +79,103 @@ type OpenstackDataPlaneServiceCert struct {
 	EDPMRoleServiceName string `json:"edpmRoleServiceName,omitempty"`
 }
 
+// CACertsSource defines a source of CA certificates for a dataplane service.
+// Exactly one of SecretRef, ConfigMapRef or ClusterTrustedBundle must be set.
+type CACertsSource struct {
+	// SecretRef - Secret holding CA certificates
+	// +kubebuilder:validation:Optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty" yaml:"secretRef,omitempty"`
+
+	// ConfigMapRef - ConfigMap holding CA certificates
+	// +kubebuilder:validation:Optional
+	ConfigMapRef *corev1.LocalObjectReference `json:"configMapRef,omitempty" yaml:"configMapRef,omitempty"`
+
+	// ClusterTrustedBundle - use the cluster-wide trusted CA bundle, which is
+	// injected into a ConfigMap created by the operator in the namespace
+	// +kubebuilder:validation:Optional
+	ClusterTrustedBundle bool `json:"clusterTrustedBundle,omitempty" yaml:"clusterTrustedBundle,omitempty"`
+
+	// Keys - keys of the Secret or ConfigMap holding CA certificates. If not
+	// set, all the keys are used.
+	// +kubebuilder:validation:Optional
+	Keys []string `json:"keys,omitempty" yaml:"keys,omitempty"`
+}
+
+// ServiceHook defines a playbook run right before or after the execution of a
+// dataplane service, in an ansible execution of its own
+type ServiceHook struct {
+	// Name - name of the hook, unique among the hooks of the service
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name" yaml:"name"`
+
+	// Playbook is a path to the playbook that ansible will run for the hook
+	// +kubebuilder:validation:Optional
+	Playbook string `json:"playbook,omitempty" yaml:"playbook,omitempty"`
+
+	// PlaybookContents is an inline playbook contents that ansible will run for
+	// the hook
+	// +kubebuilder:validation:Optional
+	PlaybookContents string `json:"playbookContents,omitempty" yaml:"playbookContents,omitempty"`
+
+	// RunOn - where the hook runs, either on the nodes targeted by the service,
+	// or on the ansible runner. The plays of the hook target the hosts set in
+	// the edpm_override_hosts variable.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Enum=nodes;runner
+	// +kubebuilder:default=nodes
+	RunOn string `json:"runOn,omitempty" yaml:"runOn,omitempty"`
+}
+
+// ServiceHealthCheck defines a playbook checking the health of a dataplane
+// service after its execution
+type ServiceHealthCheck struct {
+	// Playbook is a path to the playbook that ansible will run to check the
+	// health of the service
+	// +kubebuilder:validation:Optional
+	Playbook string `json:"playbook,omitempty" yaml:"playbook,omitempty"`
+
+	// PlaybookContents is an inline playbook contents that ansible will run to
+	// check the health of the service
+	// +kubebuilder:validation:Optional
+	PlaybookContents string `json:"playbookContents,omitempty" yaml:"playbookContents,omitempty"`
+
+	// Retries - number of times the health check is run again after a failure
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	Retries int32 `json:"retries,omitempty" yaml:"retries,omitempty"`
+
+	// Interval - seconds to wait before running the health check again after
+	// a failure
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=10
+	// +kubebuilder:validation:Minimum=0
+	Interval int32 `json:"interval,omitempty" yaml:"interval,omitempty"`
+
+	// Timeout - seconds after which a run of the health check not finished yet
+	// is stopped and considered failed
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:default=300
+	// +kubebuilder:validation:Minimum=1
+	Timeout int32 `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// ServiceHostSelector selects the nodes of a NodeSet a dataplane service runs
+// on. A node is selected when it matches all the set fields.
+type ServiceHostSelector struct {
+	// Labels - selector matched against the labels of the nodes
+	// +kubebuilder:validation:Optional
+	Labels *metav1.LabelSelector `json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// AnsibleVars - ansible vars of the nodes, with their values. The
+	// ansibleVars of a node override the ansibleVars of the nodeTemplate.
+	// +kubebuilder:validation:Optional
+	AnsibleVars map[string]string `json:"ansibleVars,omitempty" yaml:"ansibleVars,omitempty"`
+}
+
 // OpenStackDataPlaneServiceSpec defines the desired state of OpenStackDataPlaneService
 type OpenStackDataPlaneServiceSpec struct {
 	// ConfigMaps list of ConfigMap names to mount as ExtraMounts for the OpenStackAnsibleEE
@@ -84,6 +204,13 @@ type OpenStackDataPlaneServiceSpec struct {
 	// +kubebuilder:validation:Optional
 	CACerts string `json:"caCerts,omitempty" yaml:"caCerts,omitempty"`
 
+	// CACertsFrom - list of sources of CA certificates. When set, the CA
+	// certificates of these sources, and of CACerts, are concatenated and
+	// de-duplicated into a CA bundle Secret generated for the service, which
+	// is mounted in place of CACerts.
+	// +kubebuilder:validation:Optional
+	CACertsFrom []CACertsSource `json:"caCertsFrom,omitempty" yaml:"caCertsFrom,omitempty"`
+
 	// OpenStackAnsibleEERunnerImage image to use as the ansibleEE runner image
 	// +kubebuilder:validation:Optional
 	OpenStackAnsibleEERunnerImage string `json:"openStackAnsibleEERunnerImage,omitempty" yaml:"openStackAnsibleEERunnerImage,omitempty"`
@@ -111,6 +238,60 @@ type OpenStackDataPlaneServiceSpec struct {
 	// github.com/openstack-k8s-operators/openstack-operator/apis/core/v1beta1
 	ContainerImageFields []string `json:"containerImageFields,omitempty" yaml:"containerImageFields,omitempty"`
 
+	// AnsibleVars - ansible variables passed as extra vars to the ansible
+	// executions of this service only. They take precedence over the ansible
+	// variables of the NodeSets, and the AnsibleExtraVars of a deployment take
+	// precedence over them.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	AnsibleVars map[string]json.RawMessage `json:"ansibleVars,omitempty" yaml:"ansibleVars,omitempty"`
+
+	// AnsibleVarsFrom - list of sources to populate the ansible variables of
+	// the service from. Values defined by AnsibleVars with a duplicate key take
+	// precedence.
+	// +kubebuilder:validation:Optional
+	AnsibleVarsFrom []DataSource `json:"ansibleVarsFrom,omitempty" yaml:"ansibleVarsFrom,omitempty"`
+
+	// PreHooks - hooks run, in order, before the execution of the service
+	// +kubebuilder:validation:Optional
+	PreHooks []ServiceHook `json:"preHooks,omitempty" yaml:"preHooks,omitempty"`
+
+	// PostHooks - hooks run, in order, after the execution of the service
+	// +kubebuilder:validation:Optional
+	PostHooks []ServiceHook `json:"postHooks,omitempty" yaml:"postHooks,omitempty"`
+
+	// HealthCheck - playbook run after the execution of the service to check
+	// its health. The service is only ready once its health check passes.
+	// +kubebuilder:validation:Optional
+	HealthCheck *ServiceHealthCheck `json:"healthCheck,omitempty" yaml:"healthCheck,omitempty"`
+
+	// BackoffLimit - maximum number of retried executions of the service. If
+	// not set, the backoffLimit of the OpenStackDataPlaneDeployment is used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit *int32 `json:"backoffLimit,omitempty" yaml:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds - seconds after which an execution of the service
+	// not finished yet is stopped and reported with the Timeout reason. If not
+	// set, the activeDeadlineSeconds of the OpenStackDataPlaneDeployment is
+	// used.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=1
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty" yaml:"activeDeadlineSeconds,omitempty"`
+
+	// HostSelector - only run the service on the nodes of the NodeSet matching
+	// the selector, through the ansible limit. The service is skipped on the
+	// NodeSets without matching nodes.
+	// +kubebuilder:validation:Optional
+	HostSelector *ServiceHostSelector `json:"hostSelector,omitempty" yaml:"hostSelector,omitempty"`
+
+	// RunnerPodTemplate - scheduling and resource settings of the ansible
+	// execution pods of the service, replacing the runnerPodTemplate of the
+	// NodeSet. Not supported by the OpenStackAnsibleEE API yet, the
+	// deployments of the service fail.
+	// +kubebuilder:validation:Optional
+	RunnerPodTemplate *RunnerPodTemplate `json:"runnerPodTemplate,omitempty" yaml:"runnerPodTemplate,omitempty"`
+
 	// EDPMServiceType - service type, which typically corresponds to one of
 	// the default service names (such as nova, ovn, etc). Also typically
 	// corresponds to the ansible role name (without the "edpm_" prefix) used
@@ -124,6 +305,9 @@ type OpenStackDataPlaneServiceStatus struct {
 	// +operator-sdk:csv:customresourcedefinitions:type=status,xDescriptors={"urn:alm:descriptor:io.kubernetes.conditions"}
 	// Conditions
 	Conditions condition.Conditions `json:"conditions,omitempty" optional:"true"`
+
+	// DefaultRevision - the hash of the default spec last applied to the service
+	DefaultRevision string `json:"defaultRevision,omitempty" optional:"true"`
 }
 
 //+kubebuilder:object:root=true
@@ -17,9 +17,13 @@ limitations under the License.
 package v1beta1
 
 import (
+	"fmt"
+
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -63,7 +67,8 @@ func (r *OpenStackDataPlaneService) ValidateCreate() (admission.Warnings, error)
 
 	openstackdataplaneservicelog.Info("validate create", "name", r.Name)
 
-	errors := r.Spec.ValidateCreate()
+	errors := append(r.Spec.ValidateCreate(), r.validateHookNames()...)
+	errors = append(errors, r.validateHealthCheckName()...)
 
 	if len(errors) != 0 {
 		openstackdataplaneservicelog.Info("validation failed", "name", r.Name)
@@ -78,14 +83,15 @@ func (r *OpenStackDataPlaneService) ValidateCreate() (admission.Warnings, error)
 }
 
 func (r *OpenStackDataPlaneServiceSpec) ValidateCreate() field.ErrorList {
-	// TODO(user): fill in your validation logic upon object creation.
-
-	return field.ErrorList{}
+	errors := append(r.validateHooks(), r.validateHealthCheck()...)
+	errors = append(errors, r.validateHostSelector()...)
+	return append(errors, r.validateCACertsFrom()...)
 }
 
 func (r *OpenStackDataPlaneService) ValidateUpdate(original runtime.Object) (admission.Warnings, error) {
 	openstackdataplaneservicelog.Info("validate update", "name", r.Name)
-	errors := r.Spec.ValidateUpdate()
+	errors := append(r.Spec.ValidateUpdate(), r.validateHookNames()...)
+	errors = append(errors, r.validateHealthCheckName()...)
 
 	if len(errors) != 0 {
 		openstackdataplaneservicelog.Info("validation failed", "name", r.Name)
@@ -99,9 +105,140 @@ func (r *OpenStackDataPlaneService) ValidateUpdate(original runtime.Object) (adm
 }
 
 func (r *OpenStackDataPlaneServiceSpec) ValidateUpdate() field.ErrorList {
-	// TODO(user): fill in your validation logic upon object creation.
+	errors := append(r.validateHooks(), r.validateHealthCheck()...)
+	errors = append(errors, r.validateHostSelector()...)
+	return append(errors, r.validateCACertsFrom()...)
+}
 
-	return field.ErrorList{}
+// validateCACertsFrom checks that each source of CA certs has exactly one of
+// secretRef, configMapRef and clusterTrustedBundle
+func (r *OpenStackDataPlaneServiceSpec) validateCACertsFrom() field.ErrorList {
+	var errors field.ErrorList
+	for i, source := range r.CACertsFrom {
+		sources := 0
+		if source.SecretRef != nil {
+			sources++
+		}
+		if source.ConfigMapRef != nil {
+			sources++
+		}
+		if source.ClusterTrustedBundle {
+			sources++
+		}
+		if sources != 1 {
+			errors = append(errors, field.Invalid(field.NewPath("spec").Child("caCertsFrom").Index(i), source,
+				"exactly one of secretRef, configMapRef and clusterTrustedBundle must be set"))
+		}
+	}
+
+	return errors
+}
+
+// validateHostSelector checks the label selector of the host selector, and
+// that the service doesn't run on all the NodeSets
+func (r *OpenStackDataPlaneServiceSpec) validateHostSelector() field.ErrorList {
+	var errors field.ErrorList
+	if r.HostSelector == nil {
+		return errors
+	}
+	hostSelectorPath := field.NewPath("spec").Child("hostSelector")
+	if r.DeployOnAllNodeSets {
+		errors = append(errors, field.Invalid(hostSelectorPath, r.HostSelector,
+			"hostSelector can't be set on a service with deployOnAllNodeSets"))
+	}
+	if _, err := metav1.LabelSelectorAsSelector(r.HostSelector.Labels); err != nil {
+		errors = append(errors, field.Invalid(hostSelectorPath.Child("labels"), r.HostSelector.Labels, err.Error()))
+	}
+
+	return errors
+}
+
+// validateHealthCheck checks that the health check has exactly one of
+// playbook and playbookContents
+func (r *OpenStackDataPlaneServiceSpec) validateHealthCheck() field.ErrorList {
+	var errors field.ErrorList
+	if r.HealthCheck == nil {
+		return errors
+	}
+	if (r.HealthCheck.Playbook == "") == (r.HealthCheck.PlaybookContents == "") {
+		errors = append(errors, field.Invalid(field.NewPath("spec").Child("healthCheck"), r.HealthCheck,
+			"exactly one of playbook and playbookContents must be set"))
+	}
+
+	return errors
+}
+
+// validateHooks checks that each pre and post hook has a unique name and
+// exactly one of playbook and playbookContents
+func (r *OpenStackDataPlaneServiceSpec) validateHooks() field.ErrorList {
+	var errors field.ErrorList
+	hookLists := map[string][]ServiceHook{
+		"preHooks":  r.PreHooks,
+		"postHooks": r.PostHooks,
+	}
+	for _, hookField := range []string{"preHooks", "postHooks"} {
+		hookNames := map[string]bool{}
+		for i, hook := range hookLists[hookField] {
+			hookPath := field.NewPath("spec").Child(hookField).Index(i)
+			if hookNames[hook.Name] {
+				errors = append(errors, field.Duplicate(hookPath.Child("name"), hook.Name))
+			}
+			hookNames[hook.Name] = true
+			if (hook.Playbook == "") == (hook.PlaybookContents == "") {
+				errors = append(errors, field.Invalid(hookPath, hook.Name,
+					"exactly one of playbook and playbookContents must be set"))
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateHookNames checks that the name of the ansible execution of each pre
+// and post hook, <service>-<stage>-<hook>, fits in the label recording its
+// service
+func (r *OpenStackDataPlaneService) validateHookNames() field.ErrorList {
+	var errors field.ErrorList
+	hookStages := []struct {
+		field string
+		stage string
+		hooks []ServiceHook
+	}{
+		{"preHooks", "pre", r.Spec.PreHooks},
+		{"postHooks", "post", r.Spec.PostHooks},
+	}
+	for _, hookStage := range hookStages {
+		for i, hook := range hookStage.hooks {
+			hookServiceName := fmt.Sprintf("%s-%s-%s", r.Name, hookStage.stage, hook.Name)
+			if len(hookServiceName) > validation.LabelValueMaxLength {
+				errors = append(errors, field.Invalid(
+					field.NewPath("spec").Child(hookStage.field).Index(i).Child("name"), hook.Name,
+					fmt.Sprintf("the name of the hook execution %s must be no more than %d characters",
+						hookServiceName, validation.LabelValueMaxLength)))
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateHealthCheckName checks that the name of the ansible execution of the
+// last attempt of the health check, <service>-health-<attempt>, fits in the
+// label recording its service
+func (r *OpenStackDataPlaneService) validateHealthCheckName() field.ErrorList {
+	var errors field.ErrorList
+	if r.Spec.HealthCheck == nil {
+		return errors
+	}
+	healthCheckServiceName := fmt.Sprintf("%s-health-%d", r.Name, r.Spec.HealthCheck.Retries+1)
+	if len(healthCheckServiceName) > validation.LabelValueMaxLength {
+		errors = append(errors, field.Invalid(
+			field.NewPath("spec").Child("healthCheck"), r.Spec.HealthCheck.Retries,
+			fmt.Sprintf("the name of the health check execution %s must be no more than %d characters",
+				healthCheckServiceName, validation.LabelValueMaxLength)))
+	}
+
+	return errors
 }
 
 func (r *OpenStackDataPlaneService) ValidateDelete() (admission.Warnings, error) {
@@ -28,6 +28,7 @@ import (
 	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
 	"github.com/openstack-k8s-operators/lib-common/modules/storage"
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -122,6 +123,91 @@ func (in *AnsibleOpts) DeepCopy() *AnsibleOpts {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BaremetalHostStatus) DeepCopyInto(out *BaremetalHostStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BaremetalHostStatus.
+func (in *BaremetalHostStatus) DeepCopy() *BaremetalHostStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BaremetalHostStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BaremetalOverrides) DeepCopyInto(out *BaremetalOverrides) {
+	*out = *in
+	if in.UserData != nil {
+		in, out := &in.UserData, &out.UserData
+		*out = new(v1.SecretReference)
+		**out = **in
+	}
+	if in.NetworkData != nil {
+		in, out := &in.NetworkData, &out.NetworkData
+		*out = new(v1.SecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BaremetalOverrides.
+func (in *BaremetalOverrides) DeepCopy() *BaremetalOverrides {
+	if in == nil {
+		return nil
+	}
+	out := new(BaremetalOverrides)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CACertsSource) DeepCopyInto(out *CACertsSource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CACertsSource.
+func (in *CACertsSource) DeepCopy() *CACertsSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CACertsSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DNSAlias) DeepCopyInto(out *DNSAlias) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DNSAlias.
+func (in *DNSAlias) DeepCopy() *DNSAlias {
+	if in == nil {
+		return nil
+	}
+	out := new(DNSAlias)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DataSource) DeepCopyInto(out *DataSource) {
 	*out = *in
@@ -147,6 +233,21 @@ func (in *DataSource) DeepCopy() *DataSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeReplacementStatus) DeepCopyInto(out *NodeReplacementStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeReplacementStatus.
+func (in *NodeReplacementStatus) DeepCopy() *NodeReplacementStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeReplacementStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NodeSection) DeepCopyInto(out *NodeSection) {
 	*out = *in
@@ -164,6 +265,11 @@ func (in *NodeSection) DeepCopyInto(out *NodeSection) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.DNSAliases != nil {
+		in, out := &in.DNSAliases, &out.DNSAliases
+		*out = make([]DNSAlias, len(*in))
+		copy(*out, *in)
+	}
 	if in.UserData != nil {
 		in, out := &in.UserData, &out.UserData
 		*out = new(v1.SecretReference)
@@ -175,6 +281,23 @@ func (in *NodeSection) DeepCopyInto(out *NodeSection) {
 		**out = **in
 	}
 	in.Ansible.DeepCopyInto(&out.Ansible)
+	if in.PreProvisioned != nil {
+		in, out := &in.PreProvisioned, &out.PreProvisioned
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Baremetal != nil {
+		in, out := &in.Baremetal, &out.Baremetal
+		*out = new(BaremetalOverrides)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeSection.
@@ -299,6 +422,11 @@ func (in *OpenStackDataPlaneDeploymentSpec) DeepCopyInto(out *OpenStackDataPlane
 		*out = new(int32)
 		**out = **in
 	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
 	if in.AnsibleExtraVars != nil {
 		in, out := &in.AnsibleExtraVars, &out.AnsibleExtraVars
 		*out = make(map[string]json.RawMessage, len(*in))
@@ -365,6 +493,13 @@ func (in *OpenStackDataPlaneDeploymentStatus) DeepCopyInto(out *OpenStackDataPla
 			(*out)[key] = val
 		}
 	}
+	if in.AnsibleVarsHashes != nil {
+		in, out := &in.AnsibleVarsHashes, &out.AnsibleVarsHashes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.NodeSetHashes != nil {
 		in, out := &in.NodeSetHashes, &out.NodeSetHashes
 		*out = make(map[string]string, len(*in))
@@ -372,6 +507,13 @@ func (in *OpenStackDataPlaneDeploymentStatus) DeepCopyInto(out *OpenStackDataPla
 			(*out)[key] = val
 		}
 	}
+	if in.NodeSetTLSEnabled != nil {
+		in, out := &in.NodeSetTLSEnabled, &out.NodeSetTLSEnabled
+		*out = make(map[string]bool, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.ContainerImages != nil {
 		in, out := &in.ContainerImages, &out.ContainerImages
 		*out = make(map[string]string, len(*in))
@@ -481,16 +623,43 @@ func (in *OpenStackDataPlaneNodeSetSpec) DeepCopyInto(out *OpenStackDataPlaneNod
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.DNSMasqSelector != nil {
+		in, out := &in.DNSMasqSelector, &out.DNSMasqSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Services != nil {
 		in, out := &in.Services, &out.Services
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Teardown != nil {
+		in, out := &in.Teardown, &out.Teardown
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Removal != nil {
+		in, out := &in.Removal, &out.Removal
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replace != nil {
+		in, out := &in.Replace, &out.Replace
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Tags != nil {
 		in, out := &in.Tags, &out.Tags
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.RunnerPodTemplate != nil {
+		in, out := &in.RunnerPodTemplate, &out.RunnerPodTemplate
+		*out = new(RunnerPodTemplate)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenStackDataPlaneNodeSetSpec.
@@ -564,6 +733,56 @@ func (in *OpenStackDataPlaneNodeSetStatus) DeepCopyInto(out *OpenStackDataPlaneN
 			(*out)[key] = outVal
 		}
 	}
+	if in.AllAddresses != nil {
+		in, out := &in.AllAddresses, &out.AllAddresses
+		*out = make(map[string]map[networkv1beta1.NetNameStr][]string, len(*in))
+		for key, val := range *in {
+			var outVal map[networkv1beta1.NetNameStr][]string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make(map[networkv1beta1.NetNameStr][]string, len(*in))
+				for key, val := range *in {
+					var outVal []string
+					if val == nil {
+						(*out)[key] = nil
+					} else {
+						in, out := &val, &outVal
+						*out = make([]string, len(*in))
+						copy(*out, *in)
+					}
+					(*out)[key] = outVal
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.DNSAliases != nil {
+		in, out := &in.DNSAliases, &out.DNSAliases
+		*out = make(map[string]map[networkv1beta1.NetNameStr][]string, len(*in))
+		for key, val := range *in {
+			var outVal map[networkv1beta1.NetNameStr][]string
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make(map[networkv1beta1.NetNameStr][]string, len(*in))
+				for key, val := range *in {
+					var outVal []string
+					if val == nil {
+						(*out)[key] = nil
+					} else {
+						in, out := &val, &outVal
+						*out = make([]string, len(*in))
+						copy(*out, *in)
+					}
+					(*out)[key] = outVal
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
 	if in.ConfigMapHashes != nil {
 		in, out := &in.ConfigMapHashes, &out.ConfigMapHashes
 		*out = make(map[string]string, len(*in))
@@ -578,6 +797,13 @@ func (in *OpenStackDataPlaneNodeSetStatus) DeepCopyInto(out *OpenStackDataPlaneN
 			(*out)[key] = val
 		}
 	}
+	if in.AnsibleVarsHashes != nil {
+		in, out := &in.AnsibleVarsHashes, &out.AnsibleVarsHashes
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.DNSClusterAddresses != nil {
 		in, out := &in.DNSClusterAddresses, &out.DNSClusterAddresses
 		*out = make([]string, len(*in))
@@ -590,6 +816,48 @@ func (in *OpenStackDataPlaneNodeSetStatus) DeepCopyInto(out *OpenStackDataPlaneN
 			(*out)[key] = val
 		}
 	}
+	if in.DeployedTLSEnabled != nil {
+		in, out := &in.DeployedTLSEnabled, &out.DeployedTLSEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.ServiceCertSecrets != nil {
+		in, out := &in.ServiceCertSecrets, &out.ServiceCertSecrets
+		*out = make(map[string][]ServiceCertSecret, len(*in))
+		for key, val := range *in {
+			var outVal []ServiceCertSecret
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				inVal := (*in)[key]
+				in, out := &inVal, &outVal
+				*out = make([]ServiceCertSecret, len(*in))
+				for i := range *in {
+					(*in)[i].DeepCopyInto(&(*out)[i])
+				}
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.NodeReplacements != nil {
+		in, out := &in.NodeReplacements, &out.NodeReplacements
+		*out = make(map[string]NodeReplacementStatus, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.BaremetalHosts != nil {
+		in, out := &in.BaremetalHosts, &out.BaremetalHosts
+		*out = make(map[string]BaremetalHostStatus, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RemovedNodes != nil {
+		in, out := &in.RemovedNodes, &out.RemovedNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenStackDataPlaneNodeSetStatus.
@@ -688,11 +956,75 @@ func (in *OpenStackDataPlaneServiceSpec) DeepCopyInto(out *OpenStackDataPlaneSer
 			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.CACertsFrom != nil {
+		in, out := &in.CACertsFrom, &out.CACertsFrom
+		*out = make([]CACertsSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.ContainerImageFields != nil {
 		in, out := &in.ContainerImageFields, &out.ContainerImageFields
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.AnsibleVars != nil {
+		in, out := &in.AnsibleVars, &out.AnsibleVars
+		*out = make(map[string]json.RawMessage, len(*in))
+		for key, val := range *in {
+			var outVal []byte
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = make(json.RawMessage, len(*in))
+				copy(*out, *in)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	if in.AnsibleVarsFrom != nil {
+		in, out := &in.AnsibleVarsFrom, &out.AnsibleVarsFrom
+		*out = make([]DataSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PreHooks != nil {
+		in, out := &in.PreHooks, &out.PreHooks
+		*out = make([]ServiceHook, len(*in))
+		copy(*out, *in)
+	}
+	if in.PostHooks != nil {
+		in, out := &in.PostHooks, &out.PostHooks
+		*out = make([]ServiceHook, len(*in))
+		copy(*out, *in)
+	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(ServiceHealthCheck)
+		**out = **in
+	}
+	if in.BackoffLimit != nil {
+		in, out := &in.BackoffLimit, &out.BackoffLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.HostSelector != nil {
+		in, out := &in.HostSelector, &out.HostSelector
+		*out = new(ServiceHostSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RunnerPodTemplate != nil {
+		in, out := &in.RunnerPodTemplate, &out.RunnerPodTemplate
+		*out = new(RunnerPodTemplate)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OpenStackDataPlaneServiceSpec.
@@ -756,3 +1088,124 @@ func (in *OpenstackDataPlaneServiceCert) DeepCopy() *OpenstackDataPlaneServiceCe
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerPodTemplate) DeepCopyInto(out *RunnerPodTemplate) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerPodTemplate.
+func (in *RunnerPodTemplate) DeepCopy() *RunnerPodTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerPodTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceCertSecret) DeepCopyInto(out *ServiceCertSecret) {
+	*out = *in
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceCertSecret.
+func (in *ServiceCertSecret) DeepCopy() *ServiceCertSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceCertSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceHealthCheck) DeepCopyInto(out *ServiceHealthCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceHealthCheck.
+func (in *ServiceHealthCheck) DeepCopy() *ServiceHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceHostSelector) DeepCopyInto(out *ServiceHostSelector) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AnsibleVars != nil {
+		in, out := &in.AnsibleVars, &out.AnsibleVars
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceHostSelector.
+func (in *ServiceHostSelector) DeepCopy() *ServiceHostSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceHostSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceHook) DeepCopyInto(out *ServiceHook) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceHook.
+func (in *ServiceHook) DeepCopy() *ServiceHook {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceHook)
+	in.DeepCopyInto(out)
+	return out
+}
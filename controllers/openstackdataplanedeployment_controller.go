@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/go-playground/validator/v10"
+	"golang.org/x/exp/slices"
 	corev1 "k8s.io/api/core/v1"
 	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -57,6 +58,7 @@ func (r *OpenStackDataPlaneDeploymentReconciler) GetLogger(ctx context.Context)
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanedeployments/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanedeployments/finalizers,verbs=update
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanenodesets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanenodesets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplaneservices,verbs=get;list;watch
 //+kubebuilder:rbac:groups=ansibleee.openstack.org,resources=openstackansibleees,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete;
@@ -148,6 +150,9 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 	if instance.Status.SecretHashes == nil {
 		instance.Status.SecretHashes = make(map[string]string)
 	}
+	if instance.Status.AnsibleVarsHashes == nil {
+		instance.Status.AnsibleVarsHashes = make(map[string]string)
+	}
 	if instance.Status.NodeSetHashes == nil {
 		instance.Status.NodeSetHashes = make(map[string]string)
 	}
@@ -157,6 +162,8 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 
 	// Ensure NodeSets
 	nodeSets := dataplanev1.OpenStackDataPlaneNodeSetList{}
+	certNodes := map[string]map[string]dataplanev1.NodeSection{}
+	_, isNodeRemoval := instance.Labels[deployment.NodeRemovalLabel]
 	for _, nodeSet := range instance.Spec.NodeSets {
 
 		// Fetch the OpenStackDataPlaneNodeSet instance
@@ -183,6 +190,10 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 			// Error reading the object - requeue the request.
 			return ctrl.Result{}, err
 		}
+		// The nodes in the Removing state are only deployed by their removal
+		// deployment
+		certNodes[nodeSet] = deployment.GetCertNodes(nodeSetInstance)
+		nodeSetInstance.Spec.Nodes = deployment.GetInventoryNodes(nodeSetInstance, isNodeRemoval)
 		nodeSets.Items = append(nodeSets.Items, *nodeSetInstance)
 	}
 
@@ -195,15 +206,37 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 	}
 
 	// get TLS certs
-	for _, nodeSet := range nodeSets.Items {
+	for i := range nodeSets.Items {
+		// take a reference so the cert secrets recorded in the nodeset
+		// status are visible when the services are deployed
+		nodeSet := &nodeSets.Items[i]
 		if nodeSet.Spec.TLSEnabled {
-			var services []string
-			if len(instance.Spec.ServicesOverride) != 0 {
-				services = instance.Spec.ServicesOverride
-			} else {
-				services = nodeSet.Spec.Services
-			}
 			nsConditions := instance.Status.NodeSetConditions[nodeSet.Name]
+			services, tlsTransitionServices, err := getNodeSetServices(ctx, helper, instance, nodeSet)
+			if err != nil {
+				instance.Status.Conditions.MarkFalse(
+					condition.InputReadyCondition,
+					condition.ErrorReason,
+					condition.SeverityError,
+					dataplanev1.ServiceErrorMessage,
+					err.Error())
+				nsConditions.MarkFalse(
+					dataplanev1.NodeSetDeploymentReadyCondition,
+					condition.ErrorReason,
+					condition.SeverityError,
+					dataplanev1.ServiceErrorMessage,
+					err.Error())
+				return ctrl.Result{}, err
+			}
+			// When TLS is being enabled, issue the certs of all the services
+			// of the NodeSet
+			if len(tlsTransitionServices) != 0 {
+				for _, serviceName := range nodeSet.Spec.Services {
+					if !slices.Contains(services, serviceName) {
+						services = append(services, serviceName)
+					}
+				}
+			}
 
 			for _, serviceName := range services {
 				service, err := deployment.GetService(ctx, helper, serviceName)
@@ -223,9 +256,16 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 					return ctrl.Result{}, err
 				}
 				if service.Spec.TLSCerts != nil {
+					// The certs are handled for all the nodes of the NodeSet,
+					// so that the regular and the removal deployments share
+					// the same cert secrets
+					certNodeSet := nodeSet.DeepCopy()
+					certNodeSet.Spec.Nodes = certNodes[nodeSet.Name]
 					for certKey := range service.Spec.TLSCerts {
-						result, err := deployment.EnsureTLSCerts(ctx, helper, &nodeSet,
-							nodeSet.Status.AllHostnames, nodeSet.Status.AllIPs, service, certKey)
+						result, err := deployment.EnsureTLSCerts(ctx, helper, certNodeSet,
+							nodeSet.Status.AllHostnames, nodeSet.Status.AllIPs, nodeSet.Status.DNSAliases,
+							service, certKey)
+						nodeSet.Status.ServiceCertSecrets = certNodeSet.Status.ServiceCertSecrets
 						if err != nil {
 							instance.Status.Conditions.MarkFalse(
 								condition.InputReadyCondition,
@@ -245,6 +285,24 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 						}
 					}
 				}
+				result, err := deployment.EnsureCACertsBundle(ctx, helper, &service)
+				if err != nil {
+					instance.Status.Conditions.MarkFalse(
+						condition.InputReadyCondition,
+						condition.ErrorReason,
+						condition.SeverityError,
+						condition.TLSInputErrorMessage,
+						err.Error())
+					nsConditions.MarkFalse(
+						dataplanev1.NodeSetDeploymentReadyCondition,
+						condition.ErrorReason,
+						condition.SeverityError,
+						condition.TLSInputErrorMessage,
+						err.Error())
+					return ctrl.Result{}, err
+				} else if (*result != ctrl.Result{}) {
+					return *result, nil // requeue here
+				}
 			}
 		}
 	}
@@ -253,9 +311,11 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 	// Mark InputReadyCondition=True
 	instance.Status.Conditions.MarkTrue(condition.InputReadyCondition, condition.InputReadyMessage)
 	shouldRequeue := false
+	var requeueAfter time.Duration
 	haveError := false
 	deploymentErrMsg := ""
 	backoffLimitReached := false
+	timeoutReached := false
 
 	globalInventorySecrets := map[string]string{}
 	globalSSHKeySecrets := map[string]string{}
@@ -263,7 +323,10 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 	// Gathering individual inventory and ssh secrets for later use
 	for _, nodeSet := range nodeSets.Items {
 		// Add inventory secret to list of inventories for global services
-		globalInventorySecrets[nodeSet.Name] = fmt.Sprintf("dataplanenodeset-%s", nodeSet.Name)
+		globalInventorySecrets[nodeSet.Name] = deployment.GetInventorySecretName(&nodeSet)
+		if isNodeRemoval {
+			globalInventorySecrets[nodeSet.Name] = deployment.GetRemovalInventorySecretName(&nodeSet)
+		}
 		globalSSHKeySecrets[nodeSet.Name] = nodeSet.Spec.NodeTemplate.AnsibleSSHPrivateKeySecret
 	}
 
@@ -328,14 +391,17 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 		// deploy those services for each OpenStackDataPlaneNodeSet. Otherwise,
 		// deploy with the OpenStackDataPlaneNodeSet's Services.
 		var deployResult *ctrl.Result
-		if len(instance.Spec.ServicesOverride) != 0 {
-			deployResult, err = deployer.Deploy(instance.Spec.ServicesOverride)
-		} else {
-			deployResult, err = deployer.Deploy(nodeSet.Spec.Services)
+		services, tlsTransitionServices, err := getNodeSetServices(ctx, helper, instance, &nodeSet)
+		if err == nil {
+			deployResult, err = deployer.Deploy(services)
 		}
 
 		nsConditions := instance.Status.NodeSetConditions[nodeSet.Name]
 		nsConditions.Set(nsConditions.Mirror(dataplanev1.NodeSetDeploymentReadyCondition))
+		if len(tlsTransitionServices) != 0 {
+			nsConditions.Set(deployment.GetTLSTransitionCondition(nsConditions, tlsTransitionServices))
+			instance.Status.NodeSetConditions[nodeSet.Name] = nsConditions
+		}
 
 		if err != nil {
 			util.LogErrorForObject(helper, err, fmt.Sprintf("OpenStackDeployment error for NodeSet %s", nodeSet.Name), instance)
@@ -349,10 +415,14 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 			}
 			errorReason := nsConditions.Get(dataplanev1.NodeSetDeploymentReadyCondition).Reason
 			backoffLimitReached = errorReason == condition.JobReasonBackoffLimitExceeded
+			timeoutReached = errorReason == dataplanev1.TimeoutReason
 		}
 
 		if deployResult != nil {
 			shouldRequeue = true
+			if deployResult.RequeueAfter > 0 && (requeueAfter == 0 || deployResult.RequeueAfter < requeueAfter) {
+				requeueAfter = deployResult.RequeueAfter
+			}
 		} else {
 			Log.Info("OpenStackDeployment succeeded for NodeSet", "NodeSet", nodeSet.Name)
 			Log.Info("Set NodeSetDeploymentReadyCondition true", "nodeSet", nodeSet.Name)
@@ -370,6 +440,10 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 			reason = condition.JobReasonBackoffLimitExceeded
 			severity = condition.SeverityError
 		}
+		if timeoutReached {
+			reason = dataplanev1.TimeoutReason
+			severity = condition.SeverityError
+		}
 		instance.Status.Conditions.MarkFalse(
 			condition.DeploymentReadyCondition,
 			reason,
@@ -381,14 +455,14 @@ func (r *OpenStackDataPlaneDeploymentReconciler) Reconcile(ctx context.Context,
 
 	if shouldRequeue {
 		Log.Info("Not all NodeSets done for OpenStackDeployment")
-		return ctrl.Result{}, nil
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
 	}
 
 	Log.Info("Set DeploymentReadyCondition true")
 	instance.Status.Conditions.MarkTrue(condition.DeploymentReadyCondition, condition.DeploymentReadyMessage)
 	Log.Info("Set Status.Deployed to true", "instance", instance)
 	instance.Status.Deployed = true
-	if version != nil {
+	if version != nil && !instance.Spec.HealthCheckOnly {
 		instance.Status.DeployedVersion = version.Spec.TargetVersion
 	}
 	err = r.setHashes(ctx, helper, instance, nodeSets)
@@ -433,19 +507,76 @@ func (r *OpenStackDataPlaneDeploymentReconciler) setHashes(
 			serviceName,
 			instance.Status.ConfigMapHashes,
 			instance.Status.SecretHashes,
-			nodeSets)
+			instance.Status.AnsibleVarsHashes,
+			nodeSets,
+			instance.Spec.ServicesOverride)
 		if err != nil {
 			return err
 		}
 	}
 
+	if instance.Status.NodeSetTLSEnabled == nil {
+		instance.Status.NodeSetTLSEnabled = make(map[string]bool)
+	}
 	for _, nodeSet := range nodeSets.Items {
 		instance.Status.NodeSetHashes[nodeSet.Name] = nodeSet.Status.ConfigHash
+		// A deployment with servicesOverride doesn't run all the services
+		// of the NodeSet, and doesn't complete its TLS transition
+		if len(instance.Spec.ServicesOverride) == 0 {
+			instance.Status.NodeSetTLSEnabled[nodeSet.Name] = nodeSet.Spec.TLSEnabled
+		}
 	}
 
 	return nil
 }
 
+// getNodeSetServices returns the services to deploy on a NodeSet, along with the
+// services completing a pending TLS transition of the NodeSet, which are run
+// before any other service. A deployment with servicesOverride only runs its
+// own services, in the order of the transition, and doesn't complete it.
+func getNodeSetServices(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneDeployment,
+	nodeSet *dataplanev1.OpenStackDataPlaneNodeSet,
+) ([]string, []string, error) {
+	var services []string
+	if len(instance.Spec.ServicesOverride) != 0 {
+		services = instance.Spec.ServicesOverride
+	} else {
+		services = nodeSet.Spec.Services
+	}
+	// A deleted NodeSet only runs its teardown services
+	if !nodeSet.IsTLSTransitionPending() || !nodeSet.DeletionTimestamp.IsZero() {
+		return slices.Clone(services), nil, nil
+	}
+
+	tlsTransitionServices, err := deployment.GetTLSTransitionServices(ctx, helper, nodeSet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(instance.Spec.ServicesOverride) != 0 {
+		orderedServices := []string{}
+		for _, serviceName := range tlsTransitionServices {
+			if slices.Contains(services, serviceName) {
+				orderedServices = append(orderedServices, serviceName)
+			}
+		}
+		for _, serviceName := range services {
+			if !slices.Contains(orderedServices, serviceName) {
+				orderedServices = append(orderedServices, serviceName)
+			}
+		}
+		return orderedServices, nil, nil
+	}
+	orderedServices := slices.Clone(tlsTransitionServices)
+	for _, serviceName := range services {
+		if !slices.Contains(orderedServices, serviceName) {
+			orderedServices = append(orderedServices, serviceName)
+		}
+	}
+
+	return orderedServices, tlsTransitionServices, nil
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *OpenStackDataPlaneDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
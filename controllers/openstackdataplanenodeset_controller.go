@@ -22,7 +22,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-playground/validator/v10"
 	"golang.org/x/exp/slices"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -35,6 +34,8 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -66,8 +67,9 @@ const (
 // OpenStackDataPlaneNodeSetReconciler reconciles a OpenStackDataPlaneNodeSet object
 type OpenStackDataPlaneNodeSetReconciler struct {
 	client.Client
-	Kclient kubernetes.Interface
-	Scheme  *runtime.Scheme
+	Kclient        kubernetes.Interface
+	Scheme         *runtime.Scheme
+	ServiceCatalog *deployment.ServiceCatalog
 }
 
 // GetLogger returns a logger object with a prefix of "controller.name" and additional controller context fields
@@ -79,10 +81,13 @@ func (r *OpenStackDataPlaneNodeSetReconciler) GetLogger(ctx context.Context) log
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanenodesets/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanenodesets/finalizers,verbs=update
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplaneservices,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplanedeployments,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete;
 //+kubebuilder:rbac:groups=dataplane.openstack.org,resources=openstackdataplaneservices/finalizers,verbs=update
 //+kubebuilder:rbac:groups=baremetal.openstack.org,resources=openstackbaremetalsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=baremetal.openstack.org,resources=openstackbaremetalsets/status,verbs=get
 //+kubebuilder:rbac:groups=baremetal.openstack.org,resources=openstackbaremetalsets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=metal3.io,resources=baremetalhosts,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete;
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete;
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete;
@@ -133,8 +138,6 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 	Log := r.GetLogger(ctx)
 	Log.Info("Reconciling NodeSet")
 
-	validate := validator.New()
-
 	// Fetch the OpenStackDataPlaneNodeSet instance
 	instance := &dataplanev1.OpenStackDataPlaneNodeSet{}
 	err := r.Client.Get(ctx, req.NamespacedName, instance)
@@ -195,12 +198,34 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 		}
 	}()
 
+	// Handle the deletion of the NodeSet
+	if !instance.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, helper, instance)
+	}
+
+	// Add the finalizer so that the nodes are torn down before their IPs, DNS
+	// records and baremetal hosts are released. The finalizer is persisted by
+	// the deferred patch of the instance.
+	if controllerutil.AddFinalizer(instance, helper.GetFinalizer()) {
+		return ctrl.Result{}, nil
+	}
+
 	if instance.Status.ConfigMapHashes == nil {
 		instance.Status.ConfigMapHashes = make(map[string]string)
 	}
+	// NodeSets deployed before DeployedTLSEnabled was recorded are assumed to
+	// be deployed with their current tlsEnabled, so that only a later change
+	// of tlsEnabled starts a TLS transition
+	if instance.Status.DeployedTLSEnabled == nil && instance.Status.DeployedConfigHash != "" {
+		tlsEnabled := instance.Spec.TLSEnabled
+		instance.Status.DeployedTLSEnabled = &tlsEnabled
+	}
 	if instance.Status.SecretHashes == nil {
 		instance.Status.SecretHashes = make(map[string]string)
 	}
+	if instance.Status.AnsibleVarsHashes == nil {
+		instance.Status.AnsibleVarsHashes = make(map[string]string)
+	}
 	if instance.Status.ContainerImages == nil {
 		instance.Status.ContainerImages = make(map[string]string)
 	}
@@ -218,7 +243,7 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 	}
 
 	// Ensure Services
-	err = deployment.EnsureServices(ctx, helper, instance, validate)
+	err = deployment.EnsureServices(ctx, helper, instance, r.ServiceCatalog)
 	if err != nil {
 		instance.Status.Conditions.MarkFalse(
 			dataplanev1.SetupReadyCondition,
@@ -246,12 +271,14 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 	instance.Status.CtlplaneSearchDomain = dnsDetails.CtlplaneSearchDomain
 	instance.Status.AllHostnames = dnsDetails.Hostnames
 	instance.Status.AllIPs = dnsDetails.AllIPs
+	instance.Status.AllAddresses = dnsDetails.AllAddresses
+	instance.Status.DNSAliases = dnsDetails.DNSAliases
 
 	ansibleSSHPrivateKeySecret := instance.Spec.NodeTemplate.AnsibleSSHPrivateKeySecret
 
 	secretKeys := []string{}
 	secretKeys = append(secretKeys, AnsibleSSHPrivateKey)
-	if !instance.Spec.PreProvisioned {
+	if instance.Spec.HasBaremetalNodes() {
 		secretKeys = append(secretKeys, AnsibleSSHAuthorizedKeys)
 	}
 	_, result, err = secret.VerifySecret(
@@ -363,7 +390,7 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 	containerImages := dataplaneutil.GetContainerImages(version)
 
 	// Reconcile BaremetalSet if required
-	if !instance.Spec.PreProvisioned {
+	if instance.Spec.HasBaremetalNodes() {
 		// Reset the NodeSetBareMetalProvisionReadyCondition to unknown
 		instance.Status.Conditions.MarkUnknown(dataplanev1.NodeSetBareMetalProvisionReadyCondition,
 			condition.InitReason, condition.InitReason)
@@ -385,7 +412,8 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 		}
 	}
 
-	isDeploymentReady, isDeploymentRunning, isDeploymentFailed, err := checkDeployment(helper, instance)
+	isDeploymentReady, isDeploymentRunning, failedCondition, err := checkDeployment(helper, instance)
+	isDeploymentFailed := failedCondition != nil
 	if !isDeploymentFailed && err != nil {
 		instance.Status.Conditions.MarkFalse(
 			condition.DeploymentReadyCondition,
@@ -441,17 +469,93 @@ func (r *OpenStackDataPlaneNodeSetReconciler) Reconcile(ctx context.Context, req
 		if err != nil {
 			deployErrorMsg = err.Error()
 		}
+		// A timed out execution is reported with a reason of its own
+		var reason condition.Reason
+		reason = condition.ErrorReason
+		if failedCondition.Reason == dataplanev1.TimeoutReason {
+			reason = dataplanev1.TimeoutReason
+		}
 		instance.Status.Conditions.MarkFalse(condition.DeploymentReadyCondition,
-			condition.ErrorReason, condition.SeverityError,
+			reason, condition.SeverityError,
 			deployErrorMsg)
 	}
 
+	// Remove the nodes in the Removing state from the NodeSet
+	removalResult, removalErr := deployment.RemoveNodes(ctx, helper, instance)
+	if removalErr != nil || (removalResult != ctrl.Result{}) {
+		return removalResult, removalErr
+	}
+
+	// Run the replace services on the nodes whose hardware was replaced
+	replaceResult, replaceErr := deployment.ReplaceNodes(ctx, helper, instance)
+	if replaceErr != nil || (replaceResult != ctrl.Result{}) {
+		return replaceResult, replaceErr
+	}
+
+	// Track the enablement of TLS on an already deployed NodeSet, mirroring
+	// the progress reported by the deployment completing it. A pending
+	// transition mirrors the deployments still running it, and a completed
+	// one the deployment which completed it, for as long as it exists.
+	if instance.Spec.TLSEnabled {
+		var tlsTransitionCondition *condition.Condition
+		isTLSTransitionPending := instance.IsTLSTransitionPending()
+		if isTLSTransitionPending {
+			tlsTransitionCondition = condition.FalseCondition(
+				dataplanev1.NodeSetTLSTransitionCondition,
+				condition.RequestedReason,
+				condition.SeverityInfo,
+				dataplanev1.NodeSetTLSTransitionPendingMessage)
+		}
+		for _, deployConditions := range instance.Status.DeploymentStatuses {
+			deployCondition := deployConditions.Get(dataplanev1.NodeSetTLSTransitionCondition)
+			if deployCondition != nil && (deployCondition.Status == corev1.ConditionTrue) != isTLSTransitionPending {
+				tlsTransitionCondition = deployCondition
+			}
+		}
+		instance.Status.Conditions.Set(tlsTransitionCondition)
+	}
+
 	return ctrl.Result{}, err
 }
 
+// reconcileDelete runs the teardown services of the NodeSet and releases the
+// resources of its nodes before removing the finalizer
+func (r *OpenStackDataPlaneNodeSetReconciler) reconcileDelete(ctx context.Context,
+	helper *helper.Helper, instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) (ctrl.Result, error) {
+	Log := r.GetLogger(ctx)
+	Log.Info("Reconciling NodeSet delete")
+
+	if !controllerutil.ContainsFinalizer(instance, helper.GetFinalizer()) {
+		return ctrl.Result{}, nil
+	}
+
+	// The inventory of the NodeSet is kept until the finalizer is removed,
+	// so that the teardown deployment can run against the nodes
+	instance.Status.Conditions.MarkTrue(dataplanev1.SetupReadyCondition, condition.ReadyMessage)
+
+	isTeardownReady, err := deployment.TeardownNodeSet(ctx, helper, instance)
+	if err != nil || !isTeardownReady {
+		return ctrl.Result{}, err
+	}
+
+	isReleased, err := deployment.ReleaseNodeSetResources(ctx, helper, instance)
+	if err != nil || !isReleased {
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(instance, helper.GetFinalizer())
+	Log.Info("Reconciled NodeSet delete successfully")
+
+	return ctrl.Result{}, nil
+}
+
+// checkDeployment returns whether the last deployment of the NodeSet is ready or
+// running, and the NodeSetDeploymentReady condition of the failed deployment
+// when it failed
 func checkDeployment(helper *helper.Helper,
 	instance *dataplanev1.OpenStackDataPlaneNodeSet,
-) (bool, bool, bool, error) {
+) (bool, bool, *condition.Condition, error) {
 	// Get all completed deployments
 	deployments := &dataplanev1.OpenStackDataPlaneDeploymentList{}
 	opts := []client.ListOption{
@@ -460,12 +564,12 @@ func checkDeployment(helper *helper.Helper,
 	err := helper.GetClient().List(context.Background(), deployments, opts...)
 	if err != nil {
 		helper.GetLogger().Error(err, "Unable to retrieve OpenStackDataPlaneDeployment CRs %v")
-		return false, false, false, err
+		return false, false, nil, err
 	}
 
 	var isDeploymentReady bool
 	var isDeploymentRunning bool
-	var isDeploymentFailed bool
+	var failedCondition *condition.Condition
 
 	// Sort deployments from oldest to newest by the LastTransitionTime of
 	// their DeploymentReadyCondition
@@ -487,18 +591,26 @@ func checkDeployment(helper *helper.Helper,
 		if slices.Contains(
 			deployment.Spec.NodeSets, instance.Name) {
 
-			// Reset the vars for every deployment
-			isDeploymentReady = false
-			isDeploymentRunning = false
 			deploymentConditions := deployment.Status.NodeSetConditions[instance.Name]
 			if instance.Status.DeploymentStatuses == nil {
 				instance.Status.DeploymentStatuses = make(map[string]condition.Conditions)
 			}
 			instance.Status.DeploymentStatuses[deployment.Name] = deploymentConditions
+			// The deployments only running the health checks report the
+			// health of the NodeSet, and the removal and replacement
+			// deployments only run their services on some of its nodes,
+			// they don't deploy it
+			if deployment.Spec.HealthCheckOnly || isNodeRemovalOrReplacement(deployment) {
+				continue
+			}
+
+			// Reset the vars for every deployment
+			isDeploymentReady = false
+			isDeploymentRunning = false
 			deploymentCondition := deploymentConditions.Get(dataplanev1.NodeSetDeploymentReadyCondition)
 			if condition.IsError(deploymentCondition) {
 				err = fmt.Errorf(deploymentCondition.Message)
-				isDeploymentFailed = true
+				failedCondition = deploymentCondition
 				break
 			} else if deploymentConditions.IsFalse(dataplanev1.NodeSetDeploymentReadyCondition) {
 				isDeploymentRunning = true
@@ -513,17 +625,31 @@ func checkDeployment(helper *helper.Helper,
 				for k, v := range deployment.Status.SecretHashes {
 					instance.Status.SecretHashes[k] = v
 				}
+				for k, v := range deployment.Status.AnsibleVarsHashes {
+					instance.Status.AnsibleVarsHashes[k] = v
+				}
 				for k, v := range deployment.Status.ContainerImages {
 					instance.Status.ContainerImages[k] = v
 				}
 				instance.Status.DeployedConfigHash = deployment.Status.NodeSetHashes[instance.Name]
 				instance.Status.DeployedVersion = deployment.Status.DeployedVersion
+				if tlsEnabled, ok := deployment.Status.NodeSetTLSEnabled[instance.Name]; ok {
+					instance.Status.DeployedTLSEnabled = &tlsEnabled
+				}
 			}
 
 		}
 	}
 
-	return isDeploymentReady, isDeploymentRunning, isDeploymentFailed, err
+	return isDeploymentReady, isDeploymentRunning, failedCondition, err
+}
+
+// isNodeRemovalOrReplacement returns whether a deployment is run by the NodeSet
+// to remove or replace one of its nodes
+func isNodeRemovalOrReplacement(instance dataplanev1.OpenStackDataPlaneDeployment) bool {
+	_, isNodeRemoval := instance.Labels[deployment.NodeRemovalLabel]
+	_, isNodeReplacement := instance.Labels[deployment.NodeReplacementLabel]
+	return isNodeRemoval || isNodeReplacement
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -597,9 +723,30 @@ func (r *OpenStackDataPlaneNodeSetReconciler) SetupWithManager(mgr ctrl.Manager)
 			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{})).
 		Watches(&openstackv1.OpenStackVersion{},
 			handler.EnqueueRequestsFromMapFunc(r.genericWatcherFn)).
+		// The network summary of the NodeSets is published in the inventory
+		// of all the NodeSets of the namespace
+		Watches(&dataplanev1.OpenStackDataPlaneNodeSet{},
+			handler.EnqueueRequestsFromMapFunc(r.genericWatcherFn),
+			builder.WithPredicates(topologyChangedPredicate)).
 		Complete(r)
 }
 
+// topologyChangedPredicate filters the NodeSet updates changing the hostnames
+// or the addresses of their nodes
+var topologyChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldNodeSet, ok := e.ObjectOld.(*dataplanev1.OpenStackDataPlaneNodeSet)
+		if !ok {
+			return false
+		}
+		newNodeSet, ok := e.ObjectNew.(*dataplanev1.OpenStackDataPlaneNodeSet)
+		if !ok {
+			return false
+		}
+		return deployment.IsTopologyChanged(oldNodeSet, newNodeSet)
+	},
+}
+
 func (r *OpenStackDataPlaneNodeSetReconciler) secretWatcherFn(
 	ctx context.Context, obj client.Object) []reconcile.Request {
 	Log := r.GetLogger(ctx)
@@ -39,6 +39,7 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
+	metal3v1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	ansibleeev1 "github.com/openstack-k8s-operators/openstack-ansibleee-operator/api/v1beta1"
 	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
@@ -49,6 +50,7 @@ import (
 	certmgrmetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
 	"github.com/openstack-k8s-operators/dataplane-operator/controllers"
+	"github.com/openstack-k8s-operators/dataplane-operator/pkg/deployment"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -64,6 +66,7 @@ func init() {
 	utilruntime.Must(ansibleeev1.AddToScheme(scheme))
 	utilruntime.Must(networkv1.AddToScheme(scheme))
 	utilruntime.Must(baremetalv1.AddToScheme(scheme))
+	utilruntime.Must(metal3v1.AddToScheme(scheme))
 	utilruntime.Must(infranetworkv1.AddToScheme(scheme))
 	utilruntime.Must(certmgrv1.AddToScheme(scheme))
 	utilruntime.Must(certmgrmetav1.AddToScheme(scheme))
@@ -131,10 +134,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	servicesPath := deployment.GetServicesPath()
+	serviceCatalog, err := deployment.LoadServiceCatalog(servicesPath)
+	if err != nil {
+		setupLog.Error(err, "Unable to load the default services", "path", servicesPath)
+		os.Exit(1)
+	}
+	setupLog.Info("Loaded the default services", "path", servicesPath, "version", serviceCatalog.Version)
+
 	if err = (&controllers.OpenStackDataPlaneNodeSetReconciler{
-		Client:  mgr.GetClient(),
-		Scheme:  mgr.GetScheme(),
-		Kclient: kclient,
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Kclient:        kclient,
+		ServiceCatalog: serviceCatalog,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "OpenStackDataPlaneNodeSet")
 		os.Exit(1)
@@ -20,11 +20,16 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
+	metal3v1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
 	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	condition "github.com/openstack-k8s-operators/lib-common/modules/common/condition"
@@ -33,6 +38,15 @@ import (
 	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
 )
 
+const (
+	// provisionedState is the provisioning state of a provisioned BaremetalHost
+	provisionedState = "provisioned"
+
+	// defaultBmhNamespace is the namespace of the BaremetalHosts when the
+	// baremetalSetTemplate doesn't set one
+	defaultBmhNamespace = "openshift-machine-api"
+)
+
 // DeployBaremetalSet Deploy OpenStackBaremetalSet
 func DeployBaremetalSet(
 	ctx context.Context, helper *helper.Helper, instance *dataplanev1.OpenStackDataPlaneNodeSet,
@@ -49,37 +63,88 @@ func DeployBaremetalSet(
 	if instance.Spec.BaremetalSetTemplate.BaremetalHosts == nil {
 		return false, fmt.Errorf("no baremetal hosts set in baremetalSetTemplate")
 	}
+	// The nodes without a ctlplane IP from IPAM are provisioned with their
+	// ctlPlaneIP, and the gateway and DNS of the baremetalSetTemplate
+	ctlPlaneReservations := map[string]infranetworkv1.IPSetReservation{}
+	missingCtlPlaneIPs := []string{}
+	for _, node := range getActiveNodes(instance) {
+		if instance.Spec.IsNodePreProvisioned(node) {
+			continue
+		}
+		ipSet := ipSets[node.HostName]
+		// The BaremetalSet takes a single ctlplane address, use the IPv4 one
+		// on a dual-stack ctlplane network
+		res, ok := getPrimaryReservations(&ipSet)[CtlPlaneNetwork]
+		if ok {
+			ctlPlaneReservations[node.HostName] = res
+		} else if node.CtlPlaneIP == "" {
+			missingCtlPlaneIPs = append(missingCtlPlaneIPs, node.HostName)
+		}
+	}
+	if len(missingCtlPlaneIPs) != 0 {
+		sort.Strings(missingCtlPlaneIPs)
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+			condition.ErrorReason, condition.SeverityError,
+			dataplanev1.NodeSetBaremetalProvisionCtlPlaneIPErrorMessage,
+			strings.Join(missingCtlPlaneIPs, ", "))
+		return false, fmt.Errorf("no ctlplane IP from IPAM nor ctlPlaneIP for nodes %s",
+			strings.Join(missingCtlPlaneIPs, ", "))
+	}
+
+	err := checkBaremetalHostsAvailable(ctx, helper, instance)
+	if err != nil {
+		return false, err
+	}
+
+	// The nodes being replaced are left out of the BaremetalSet until their
+	// baremetal host is deprovisioned, then they are provisioned again
+	err = helper.GetClient().Get(ctx, types.NamespacedName{
+		Name:      instance.Name,
+		Namespace: instance.Namespace,
+	}, baremetalSet)
+	if err != nil && !k8s_errors.IsNotFound(err) {
+		return false, err
+	}
+	releasingHosts, err := startNodeReplacements(ctx, helper, instance, baremetalSet.Status.BaremetalHosts)
+	if err != nil {
+		return false, err
+	}
+
 	utils.LogForObject(helper, "Reconciling BaremetalSet", instance)
-	_, err := controllerutil.CreateOrPatch(ctx, helper.GetClient(), baremetalSet, func() error {
+	_, err = controllerutil.CreateOrPatch(ctx, helper.GetClient(), baremetalSet, func() error {
 		instance.Spec.BaremetalSetTemplate.DeepCopyInto(&baremetalSet.Spec)
-		for _, node := range instance.Spec.Nodes {
+		for hostName := range releasingHosts {
+			delete(baremetalSet.Spec.BaremetalHosts, hostName)
+		}
+		for _, node := range getActiveNodes(instance) {
 			hostName := node.HostName
-			ipSet, ok := ipSets[hostName]
-			instanceSpec := baremetalSet.Spec.BaremetalHosts[hostName]
+			if instance.Spec.IsNodePreProvisioned(node) || releasingHosts[hostName] {
+				continue
+			}
+			instanceSpec := instance.Spec.GetNodeInstanceSpec(node)
+			res, ok := ctlPlaneReservations[hostName]
 			if !ok {
-				// TODO: Change this to raise an error instead.
-				// NOTE(hjensas): Hardcode /24 here, this used to rely on
-				// baremetalSet.Spec.CtlplaneNetmask's default value ("255.255.255.0").
-				utils.LogForObject(helper, "IPAM Not configured for use, skipping", instance)
-				instanceSpec.CtlPlaneIP = fmt.Sprintf("%s/24", node.Ansible.AnsibleHost)
+				utils.LogForObject(helper, "IPAM not configured for the ctlplane of node, using its ctlPlaneIP", instance, "node", hostName)
+				instanceSpec.CtlPlaneIP = node.CtlPlaneIP
 			} else {
-				for _, res := range ipSet.Status.Reservation {
-					if strings.ToLower(string(res.Network)) == CtlPlaneNetwork {
-						_, ipNet, err := net.ParseCIDR(res.Cidr)
-						if err != nil {
-							return err
-						}
-						ipPrefix, _ := ipNet.Mask.Size()
-						instanceSpec.CtlPlaneIP = fmt.Sprintf("%s/%d", res.Address, ipPrefix)
-						baremetalSet.Spec.CtlplaneGateway = *res.Gateway
-						baremetalSet.Spec.BootstrapDNS = dnsAddresses
-						baremetalSet.Spec.DNSSearchDomains = []string{res.DNSDomain}
-					}
+				_, ipNet, err := net.ParseCIDR(res.Cidr)
+				if err != nil {
+					return err
+				}
+				ipPrefix, _ := ipNet.Mask.Size()
+				instanceSpec.CtlPlaneIP = fmt.Sprintf("%s/%d", res.Address, ipPrefix)
+				if res.Gateway != nil {
+					baremetalSet.Spec.CtlplaneGateway = *res.Gateway
 				}
+				baremetalSet.Spec.BootstrapDNS = dnsAddresses
+				baremetalSet.Spec.DNSSearchDomains = []string{res.DNSDomain}
 			}
 			baremetalSet.Spec.BaremetalHosts[hostName] = instanceSpec
 
 		}
+		// The baremetal hosts are kept until the teardown of the nodes is finished
+		controllerutil.AddFinalizer(baremetalSet, helper.GetFinalizer())
 		err := controllerutil.SetControllerReference(
 			helper.GetBeforeObject(), baremetalSet, helper.GetScheme())
 		return err
@@ -93,17 +158,205 @@ func DeployBaremetalSet(
 		return false, err
 	}
 
-	// Check if baremetalSet is ready
-	if !baremetalSet.IsReady() {
-		utils.LogForObject(helper, "BaremetalSet not ready, waiting...", instance)
+	// Copy the provisioning progress of the hosts, the nodes missing from the
+	// status of the BaremetalSet are not handled by it yet
+	instance.Status.BaremetalHosts = map[string]dataplanev1.BaremetalHostStatus{}
+	for _, node := range getActiveNodes(instance) {
+		if instance.Spec.IsNodePreProvisioned(node) {
+			continue
+		}
+		hostStatus, ok := baremetalSet.Status.BaremetalHosts[node.HostName]
+		if !ok {
+			continue
+		}
+		errorMessage, err := getBaremetalHostError(ctx, helper, instance, hostStatus.BmhRef)
+		if err != nil {
+			return false, err
+		}
+		instance.Status.BaremetalHosts[node.HostName] = dataplanev1.BaremetalHostStatus{
+			BmhRef:            hostStatus.BmhRef,
+			ProvisioningState: string(hostStatus.ProvisioningState),
+			ErrorMessage:      errorMessage,
+		}
+	}
+
+	if len(releasingHosts) != 0 {
+		hostNames := []string{}
+		for hostName := range releasingHosts {
+			hostNames = append(hostNames, hostName)
+		}
+		sort.Strings(hostNames)
+		utils.LogForObject(helper, "Waiting for the baremetal hosts of the replaced nodes to be released", instance)
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetNodeReplacementReadyCondition,
+			condition.RequestedReason, condition.SeverityInfo,
+			dataplanev1.NodeSetNodeReplacementReadyRunningMessage,
+			strings.Join(hostNames, ", "))
 		instance.Status.Conditions.MarkFalse(
 			dataplanev1.NodeSetBareMetalProvisionReadyCondition,
 			condition.RequestedReason, condition.SeverityInfo,
 			dataplanev1.NodeSetBaremetalProvisionReadyWaitingMessage)
 		return false, nil
 	}
+
+	// Check if baremetalSet is ready
+	if !baremetalSet.IsReady() {
+		utils.LogForObject(helper, "BaremetalSet not ready, waiting...", instance)
+		provisioned, total, waitingHosts := getBaremetalHostsProgress(instance)
+		readyCondition := baremetalSet.Status.Conditions.Get(condition.ReadyCondition)
+		switch {
+		case condition.IsError(readyCondition):
+			instance.Status.Conditions.MarkFalse(
+				dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+				condition.ErrorReason, condition.SeverityError,
+				dataplanev1.NodeSetBaremetalProvisionHostsErrorMessage,
+				provisioned, total, readyCondition.Message)
+		case len(waitingHosts) != 0:
+			instance.Status.Conditions.MarkFalse(
+				dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+				condition.RequestedReason, condition.SeverityInfo,
+				dataplanev1.NodeSetBaremetalProvisionReadyHostsWaitingMessage,
+				provisioned, total, strings.Join(waitingHosts, ", "))
+		default:
+			instance.Status.Conditions.MarkFalse(
+				dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+				condition.RequestedReason, condition.SeverityInfo,
+				dataplanev1.NodeSetBaremetalProvisionReadyWaitingMessage)
+		}
+		return false, nil
+	}
 	instance.Status.Conditions.MarkTrue(
 		dataplanev1.NodeSetBareMetalProvisionReadyCondition,
 		dataplanev1.NodeSetBaremetalProvisionReadyMessage)
 	return true, nil
 }
+
+// getBaremetalHostsProgress returns the number of provisioned nodes out of the
+// baremetal nodes, and the other nodes along with their provisioning state,
+// sorted by host name
+func getBaremetalHostsProgress(instance *dataplanev1.OpenStackDataPlaneNodeSet) (int, int, []string) {
+	provisioned := 0
+	total := 0
+	waitingHosts := []string{}
+	for _, node := range getActiveNodes(instance) {
+		if instance.Spec.IsNodePreProvisioned(node) {
+			continue
+		}
+		total++
+		hostStatus, ok := instance.Status.BaremetalHosts[node.HostName]
+		switch {
+		case !ok || hostStatus.ProvisioningState == "":
+			waitingHosts = append(waitingHosts, fmt.Sprintf("%s (pending)", node.HostName))
+		case hostStatus.ProvisioningState == provisionedState:
+			provisioned++
+		case hostStatus.ErrorMessage != "":
+			waitingHosts = append(waitingHosts,
+				fmt.Sprintf("%s (%s: %s)", node.HostName, hostStatus.ProvisioningState, hostStatus.ErrorMessage))
+		default:
+			waitingHosts = append(waitingHosts,
+				fmt.Sprintf("%s (%s)", node.HostName, hostStatus.ProvisioningState))
+		}
+	}
+	sort.Strings(waitingHosts)
+	return provisioned, total, waitingHosts
+}
+
+// getBaremetalHostError returns the last error reported by the BaremetalHost
+// of a node, which is empty while the node is not assigned a BaremetalHost
+func getBaremetalHostError(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, bmhName string,
+) (string, error) {
+	if bmhName == "" || bmhName == unassignedBMH {
+		return "", nil
+	}
+	bmhNamespace := instance.Spec.BaremetalSetTemplate.BmhNamespace
+	if bmhNamespace == "" {
+		bmhNamespace = defaultBmhNamespace
+	}
+	bmh := &metal3v1.BareMetalHost{}
+	err := helper.GetClient().Get(ctx, types.NamespacedName{Name: bmhName, Namespace: bmhNamespace}, bmh)
+	if k8s_errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return bmh.Status.ErrorMessage, nil
+}
+
+// checkBaremetalHostsAvailable verifies that there are enough available
+// BaremetalHosts matching the baremetalSetTemplate for the nodes which are not
+// assigned one yet, so that a shortfall is reported before the BaremetalSet
+// waits for them
+func checkBaremetalHostsAvailable(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) error {
+	baremetalSet := &baremetalv1.OpenStackBaremetalSet{}
+	err := helper.GetClient().Get(ctx, types.NamespacedName{
+		Name:      instance.Name,
+		Namespace: instance.Namespace,
+	}, baremetalSet)
+	if err != nil && !k8s_errors.IsNotFound(err) {
+		return err
+	}
+
+	scaleUp := &baremetalv1.OpenStackBaremetalSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: instance.Namespace,
+		},
+	}
+	instance.Spec.BaremetalSetTemplate.DeepCopyInto(&scaleUp.Spec)
+	scaleUp.Spec.BaremetalHosts = map[string]baremetalv1.InstanceSpec{}
+	for _, node := range getActiveNodes(instance) {
+		if instance.Spec.IsNodePreProvisioned(node) {
+			continue
+		}
+		bmhRef := baremetalSet.Status.BaremetalHosts[node.HostName].BmhRef
+		if bmhRef == "" || bmhRef == unassignedBMH {
+			scaleUp.Spec.BaremetalHosts[node.HostName] = baremetalv1.InstanceSpec{}
+		}
+	}
+	if len(scaleUp.Spec.BaremetalHosts) == 0 {
+		return nil
+	}
+	if scaleUp.Spec.BmhNamespace == "" {
+		scaleUp.Spec.BmhNamespace = defaultBmhNamespace
+	}
+
+	bmhs, err := baremetalv1.GetBaremetalHosts(ctx, helper.GetClient(),
+		scaleUp.Spec.BmhNamespace, scaleUp.Spec.BmhLabelSelector)
+	if meta.IsNoMatchError(err) {
+		// The BaremetalHosts are checked by the BaremetalSet itself
+		utils.LogForObject(helper, "BaremetalHost API not available, skipping the BaremetalHosts check", instance)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// The BaremetalHosts already consumed by the BaremetalSet, and not recorded
+	// in its status yet, are being provisioned for the hosts to scale up
+	assignedBmhs := map[string]bool{}
+	for _, hostStatus := range baremetalSet.Status.BaremetalHosts {
+		assignedBmhs[hostStatus.BmhRef] = true
+	}
+	consumedBmhs := &metal3v1.BareMetalHostList{}
+	for _, bmh := range bmhs.Items {
+		consumerRef := bmh.Spec.ConsumerRef
+		if consumerRef != nil && consumerRef.Kind == "OpenStackBaremetalSet" &&
+			consumerRef.Name == instance.Name && consumerRef.Namespace == instance.Namespace &&
+			!assignedBmhs[bmh.Name] {
+			consumedBmhs.Items = append(consumedBmhs.Items, bmh)
+		}
+	}
+	_, err = baremetalv1.VerifyBaremetalSetScaleUp(helper.GetLogger(), scaleUp, bmhs, consumedBmhs)
+	if err != nil {
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+			dataplanev1.InsufficientBaremetalHostsReason, condition.SeverityError,
+			dataplanev1.NodeSetBaremetalProvisionInsufficientHostsMessage,
+			len(scaleUp.Spec.BaremetalHosts), err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slices"
+	corev1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/secret"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/tls"
+)
+
+// HasCACerts returns whether CA certs are mounted for the service
+func HasCACerts(service dataplanev1.OpenStackDataPlaneService) bool {
+	return service.Spec.CACerts != "" || len(service.Spec.CACertsFrom) > 0
+}
+
+// GetServiceCACertsSecretName - return the name of the secret holding the CA certs
+// mounted for the service, which is the generated CA bundle when CACertsFrom is set.
+// The convention we use for the CA bundle is "<service>-cacerts-bundle", for example,
+// nova-cacerts-bundle.
+func GetServiceCACertsSecretName(service dataplanev1.OpenStackDataPlaneService) string {
+	if len(service.Spec.CACertsFrom) == 0 {
+		return service.Spec.CACerts
+	}
+	return fmt.Sprintf("%s-cacerts-bundle", service.Name)
+}
+
+// hasCACertsBundle returns whether the CA bundle of a service is generated by a
+// deployment, which is only done for the NodeSets with TLS enabled deploying
+// the service
+func hasCACertsBundle(serviceName string, nodeSets dataplanev1.OpenStackDataPlaneNodeSetList,
+	servicesOverride []string,
+) bool {
+	for _, nodeSet := range nodeSets.Items {
+		if !nodeSet.Spec.TLSEnabled {
+			continue
+		}
+		if len(servicesOverride) > 0 || slices.Contains(nodeSet.Spec.Services, serviceName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnsureCACertsBundle generates the CA bundle secret of a service with
+// CACertsFrom set, holding the de-duplicated CA certs of all its CA sources.
+func EnsureCACertsBundle(ctx context.Context, helper *helper.Helper,
+	service *dataplanev1.OpenStackDataPlaneService,
+) (*ctrl.Result, error) {
+	if len(service.Spec.CACertsFrom) == 0 {
+		return &ctrl.Result{}, nil
+	}
+
+	sources := []map[string][]byte{}
+	if service.Spec.CACerts != "" {
+		caCertsSecret, _, err := secret.GetSecret(ctx, helper, service.Spec.CACerts, service.Namespace)
+		if err != nil {
+			return &ctrl.Result{}, fmt.Errorf("error retrieving CA certs secret %s - %w", service.Spec.CACerts, err)
+		}
+		sources = append(sources, caCertsSecret.Data)
+	}
+
+	for _, source := range service.Spec.CACertsFrom {
+		data, err := getCACertsSourceData(ctx, helper, service.Namespace, source)
+		if k8s_errors.IsNotFound(err) && source.ClusterTrustedBundle {
+			// the cluster trusted bundle is injected asynchronously
+			helper.GetLogger().Info("Waiting for the cluster trusted CA bundle to be injected", "configMap", TrustedCABundleConfigMap)
+			return &ctrl.Result{RequeueAfter: time.Second * 5}, nil
+		} else if err != nil {
+			return &ctrl.Result{}, err
+		}
+		sources = append(sources, data)
+	}
+
+	bundle, err := createCACertsBundle(sources)
+	if err != nil {
+		return &ctrl.Result{}, fmt.Errorf("error creating CA bundle for %s - %w", service.Name, err)
+	}
+
+	bundleSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetServiceCACertsSecretName(*service),
+			Namespace: service.Namespace,
+			Labels: map[string]string{
+				ServiceLabel: service.Name,
+			},
+		},
+		Data: map[string][]byte{
+			tls.CABundleKey: bundle,
+		},
+	}
+	_, result, err := secret.CreateOrPatchSecret(ctx, helper, service, bundleSecret)
+	if err != nil {
+		return &ctrl.Result{}, fmt.Errorf("error creating CA bundle secret for %s - %w", service.Name, err)
+	} else if result != controllerutil.OperationResultNone {
+		return &ctrl.Result{RequeueAfter: time.Second * 5}, nil
+	}
+
+	return &ctrl.Result{}, nil
+}
+
+// getCACertsSourceData returns the data holding CA certs of a CA source
+func getCACertsSourceData(ctx context.Context, helper *helper.Helper,
+	namespace string, source dataplanev1.CACertsSource,
+) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	switch {
+	case source.SecretRef != nil:
+		sourceSecret, _, err := secret.GetSecret(ctx, helper, source.SecretRef.Name, namespace)
+		if err != nil {
+			return nil, err
+		}
+		data = sourceSecret.Data
+	case source.ConfigMapRef != nil || source.ClusterTrustedBundle:
+		name := TrustedCABundleConfigMap
+		if source.ConfigMapRef != nil {
+			name = source.ConfigMapRef.Name
+		} else {
+			err := ensureTrustedCABundleConfigMap(ctx, helper, namespace)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sourceConfigMap := &corev1.ConfigMap{}
+		err := helper.GetClient().Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, sourceConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		if source.ClusterTrustedBundle && len(sourceConfigMap.Data[TrustedCABundleKey]) == 0 {
+			return nil, k8s_errors.NewNotFound(corev1.Resource("configmaps"), name)
+		}
+		for k, v := range sourceConfigMap.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range sourceConfigMap.BinaryData {
+			data[k] = v
+		}
+	default:
+		return nil, fmt.Errorf("CA certs source must set one of secretRef, configMapRef or clusterTrustedBundle")
+	}
+
+	if len(source.Keys) == 0 {
+		return data, nil
+	}
+	keysData := map[string][]byte{}
+	for _, key := range source.Keys {
+		value, ok := data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in CA certs source", key)
+		}
+		keysData[key] = value
+	}
+
+	return keysData, nil
+}
+
+// ensureTrustedCABundleConfigMap creates the ConfigMap into which the cluster
+// trusted CA bundle is injected
+func ensureTrustedCABundleConfigMap(ctx context.Context, helper *helper.Helper, namespace string) error {
+	trustedCABundle := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      TrustedCABundleConfigMap,
+			Namespace: namespace,
+		},
+	}
+	_, err := controllerutil.CreateOrPatch(ctx, helper.GetClient(), trustedCABundle, func() error {
+		if trustedCABundle.Labels == nil {
+			trustedCABundle.Labels = map[string]string{}
+		}
+		trustedCABundle.Labels[TrustedCABundleInjectLabel] = "true"
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error creating trusted CA bundle configmap - %w", err)
+	}
+
+	return nil
+}
+
+// createCACertsBundle concatenates the PEM encoded certificates of the sources,
+// in the order of the sources and of their sorted keys, dropping duplicates.
+func createCACertsBundle(sources []map[string][]byte) ([]byte, error) {
+	var bundle bytes.Buffer
+	seen := map[string]bool{}
+	for _, data := range sources {
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			rest := data[key]
+			for {
+				var block *pem.Block
+				block, rest = pem.Decode(rest)
+				if block == nil {
+					break
+				}
+				if block.Type != "CERTIFICATE" || seen[string(block.Bytes)] {
+					continue
+				}
+				seen[string(block.Bytes)] = true
+				err := pem.Encode(&bundle, &pem.Block{Type: block.Type, Bytes: block.Bytes})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if bundle.Len() == 0 {
+		return nil, fmt.Errorf("no CA certificates found in the CA certs sources")
+	}
+
+	return bundle.Bytes(), nil
+}
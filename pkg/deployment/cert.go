@@ -27,8 +27,11 @@ import (
 	"golang.org/x/exp/slices"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	certmgrv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
@@ -39,39 +42,54 @@ import (
 	"github.com/openstack-k8s-operators/lib-common/modules/common/secret"
 )
 
+// certsSecretData holds the cert files of the hosts packed into one secret
+type certsSecretData struct {
+	hosts []string
+	data  map[string][]byte
+	size  int
+}
+
 // Generates an organized data structure that is leveraged to create the secrets.
+// The files of each host are packed first-fit, in sorted host order, into as few
+// secrets as possible without exceeding secretMaxSize. The files of a single host
+// are never split across secrets.
 func createSecretsDataStructure(secretMaxSize int,
-	certsData map[string][]byte,
-) []map[string][]byte {
-	ci := []map[string][]byte{}
+	certsData map[string]map[string][]byte,
+) ([]certsSecretData, error) {
+	ci := []certsSecretData{}
 
-	keys := []string{}
-	for k := range certsData {
-		keys = append(keys, k)
+	hosts := make([]string, 0, len(certsData))
+	for host := range certsData {
+		hosts = append(hosts, host)
 	}
-	sort.Strings(keys)
-
-	totalSize := secretMaxSize
-	var cur *map[string][]byte
-	// Going 3 by 3 to include CA, crt and key, in the same secret.
-	for k := 0; k < len(keys)-1; k += 3 {
-		szCa := len(certsData[keys[k]]) + len(keys[k])
-		szCrt := len(certsData[keys[k+1]]) + len(keys[k+1])
-		szKey := len(certsData[keys[k+2]]) + len(keys[k+2])
-		sz := szCa + szCrt + szKey
-		if (totalSize + sz) > secretMaxSize {
-			i := len(ci)
-			ci = append(ci, make(map[string][]byte))
-			cur = &ci[i]
-			totalSize = 0
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		sz := 0
+		for key, data := range certsData[host] {
+			sz += len(key) + len(data)
+		}
+		if sz > secretMaxSize {
+			return nil, fmt.Errorf(
+				"certs for host %s are %d bytes, which exceeds the maximum secret size of %d bytes",
+				host, sz, secretMaxSize)
+		}
+
+		i := slices.IndexFunc(ci, func(s certsSecretData) bool {
+			return s.size+sz <= secretMaxSize
+		})
+		if i < 0 {
+			i = len(ci)
+			ci = append(ci, certsSecretData{data: make(map[string][]byte)})
+		}
+		for key, data := range certsData[host] {
+			ci[i].data[key] = data
 		}
-		totalSize += sz
-		(*cur)[keys[k]] = certsData[keys[k]]
-		(*cur)[keys[k+1]] = certsData[keys[k+1]]
-		(*cur)[keys[k+2]] = certsData[keys[k+2]]
+		ci[i].hosts = append(ci[i].hosts, host)
+		ci[i].size += sz
 	}
 
-	return ci
+	return ci, nil
 }
 
 // EnsureTLSCerts generates secrets containing all the certificates for the relevant service
@@ -80,10 +98,11 @@ func EnsureTLSCerts(ctx context.Context, helper *helper.Helper,
 	instance *dataplanev1.OpenStackDataPlaneNodeSet,
 	allHostnames map[string]map[infranetworkv1.NetNameStr]string,
 	allIPs map[string]map[infranetworkv1.NetNameStr]string,
+	allDNSAliases map[string]map[infranetworkv1.NetNameStr][]string,
 	service dataplanev1.OpenStackDataPlaneService,
 	certKey string,
 ) (*ctrl.Result, error) {
-	certsData := map[string][]byte{}
+	certsData := map[string]map[string][]byte{}
 	secretMaxSize := instance.Spec.SecretMaxSize
 
 	// for each node in the nodeset, issue all the TLS certs needed based on the
@@ -113,6 +132,7 @@ func EnsureTLSCerts(ctx context.Context, helper *helper.Helper,
 
 		dnsNames = allHostnames[hostName]
 		ipsMap = allIPs[hostName]
+		dnsAliases := allDNSAliases[hostName]
 
 		dnsNamesInCert := slices.Contains(service.Spec.TLSCerts[certKey].Contents, DNSNamesStr)
 		ipValuesInCert := slices.Contains(service.Spec.TLSCerts[certKey].Contents, IPValuesStr)
@@ -124,11 +144,15 @@ func EnsureTLSCerts(ctx context.Context, helper *helper.Helper,
 				for _, host := range dnsNames {
 					hosts = append(hosts, host)
 				}
+				for _, aliases := range dnsAliases {
+					hosts = append(hosts, aliases...)
+				}
 			} else {
 				hosts = make([]string, 0, len(service.Spec.TLSCerts[certKey].Networks))
 				for _, network := range service.Spec.TLSCerts[certKey].Networks {
 					certNetwork := strings.ToLower(string(network))
 					hosts = append(hosts, dnsNames[infranetworkv1.NetNameStr(certNetwork)])
+					hosts = append(hosts, dnsAliases[infranetworkv1.NetNameStr(certNetwork)]...)
 				}
 			}
 		}
@@ -182,35 +206,87 @@ func EnsureTLSCerts(ctx context.Context, helper *helper.Helper,
 		// We'll do this once stuggi adds a function to do this in libcommon
 
 		// To use this cert, add it to the relevant service data
-		certsData[baseName+"-tls.key"] = certSecret.Data["tls.key"]
-		certsData[baseName+"-tls.crt"] = certSecret.Data["tls.crt"]
-		certsData[baseName+"-ca.crt"] = certSecret.Data["ca.crt"]
+		certsData[hostName] = map[string][]byte{}
+		for _, file := range hostCertsFiles {
+			certsData[hostName][getHostCertsKey(baseName, file)] = certSecret.Data[file]
+		}
 	}
 
 	// Calculate number of secrets to create
-	ci := createSecretsDataStructure(secretMaxSize, certsData)
-
-	labels := map[string]string{
-		"numberOfSecrets": strconv.Itoa(len(ci)),
+	ci, err := createSecretsDataStructure(secretMaxSize, certsData)
+	if err != nil {
+		return &ctrl.Result{}, err
 	}
+
 	// create secrets to hold the certs for the services
+	changed := false
+	certSecrets := make([]dataplanev1.ServiceCertSecret, 0, len(ci))
 	for i := range ci {
-		labels["secretNumber"] = strconv.Itoa(i)
 		serviceCertsSecret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      GetServiceCertsSecretName(instance, service.Name, certKey, i),
 				Namespace: instance.Namespace,
-				Labels:    labels,
+				Labels: map[string]string{
+					"secretNumber": strconv.Itoa(i),
+				},
 			},
-			Data: ci[i],
+			Data: ci[i].data,
 		}
 		_, result, err := secret.CreateOrPatchSecret(ctx, helper, instance, serviceCertsSecret)
 		if err != nil {
 			err = fmt.Errorf("error creating certs secret for %s - %w", service.Name, err)
 			return &ctrl.Result{}, err
 		} else if result != controllerutil.OperationResultNone {
-			return &ctrl.Result{RequeueAfter: time.Second * 5}, nil
+			changed = true
+		}
+		// CreateOrPatchSecret merges the labels, the ones which are no longer
+		// set have to be removed explicitly
+		err = removeCertsSecretLabels(ctx, helper, serviceCertsSecret, staleCertsSecretLabels)
+		if err != nil {
+			err = fmt.Errorf("error removing stale labels of certs secret for %s - %w", service.Name, err)
+			return &ctrl.Result{}, err
+		}
+		certSecrets = append(certSecrets, dataplanev1.ServiceCertSecret{
+			Name:  serviceCertsSecret.Name,
+			Hosts: ci[i].hosts,
+		})
+	}
+
+	// delete the secrets left over from a previous, larger, set of secrets
+	for i := len(ci); ; i++ {
+		staleSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetServiceCertsSecretName(instance, service.Name, certKey, i),
+				Namespace: instance.Namespace,
+			},
+		}
+		err = helper.GetClient().Delete(ctx, staleSecret)
+		if k8s_errors.IsNotFound(err) {
+			break
+		} else if err != nil {
+			err = fmt.Errorf("error deleting stale certs secret %s - %w", staleSecret.Name, err)
+			return &ctrl.Result{}, err
 		}
+		changed = true
+	}
+
+	// record the secrets in the nodeset status so they can be mounted
+	statusKey := GetServiceCertsStatusKey(service.Name, certKey)
+	if !equality.Semantic.DeepEqual(instance.Status.ServiceCertSecrets[statusKey], certSecrets) {
+		patch := client.MergeFrom(instance.DeepCopy())
+		if instance.Status.ServiceCertSecrets == nil {
+			instance.Status.ServiceCertSecrets = map[string][]dataplanev1.ServiceCertSecret{}
+		}
+		instance.Status.ServiceCertSecrets[statusKey] = certSecrets
+		err = helper.GetClient().Status().Patch(ctx, instance, patch)
+		if err != nil {
+			err = fmt.Errorf("error recording certs secrets for %s in nodeset status - %w", service.Name, err)
+			return &ctrl.Result{}, err
+		}
+	}
+
+	if changed {
+		return &ctrl.Result{RequeueAfter: time.Second * 5}, nil
 	}
 
 	return &ctrl.Result{}, nil
@@ -275,6 +351,34 @@ func GetTLSNodeCert(ctx context.Context, helper *helper.Helper,
 	return certSecret, ctrl.Result{}, nil
 }
 
+// staleCertsSecretLabels - the labels previously set on the service certs secrets.
+// The number of secrets is now given by the ServiceCertSecrets status of the nodeset.
+var staleCertsSecretLabels = []string{"numberOfSecrets"}
+
+// removeCertsSecretLabels - remove the given labels from a service certs secret
+func removeCertsSecretLabels(ctx context.Context, helper *helper.Helper,
+	certsSecret *corev1.Secret, labels []string,
+) error {
+	existing := &corev1.Secret{}
+	err := helper.GetClient().Get(ctx, client.ObjectKeyFromObject(certsSecret), existing)
+	if err != nil {
+		return err
+	}
+	patch := client.MergeFrom(existing.DeepCopy())
+	removed := false
+	for _, label := range labels {
+		if _, ok := existing.Labels[label]; ok {
+			delete(existing.Labels, label)
+			removed = true
+		}
+	}
+	if !removed {
+		return nil
+	}
+
+	return helper.GetClient().Patch(ctx, existing, patch)
+}
+
 // GetServiceCertsSecretName - return name of secret to be mounted in ansibleEE which contains
 // all the TLS certs that fit in a secret for the relevant service. The index variable is used
 // to make the secret name unique.
@@ -284,3 +388,46 @@ func GetServiceCertsSecretName(instance *dataplanev1.OpenStackDataPlaneNodeSet,
 	certKey string, index int) string {
 	return fmt.Sprintf("%s-%s-%s-certs-%s", instance.Name, serviceName, certKey, strconv.Itoa(index))
 }
+
+// hostCertsFiles - the files of the cert secret of a host that are held in the
+// service certs secrets
+var hostCertsFiles = []string{"tls.key", "tls.crt", "ca.crt"}
+
+// getHostCertsKey - return the key of a file of a host in the service certs secrets,
+// which is prefixed with the ctlplane DNS name of the host.
+func getHostCertsKey(baseName string, file string) string {
+	return baseName + "-" + file
+}
+
+// getHostCertsItems - return the items of a service certs secret holding the files
+// of the given hosts, so that only those files are projected into a volume.
+func getHostCertsItems(certsSecret *corev1.Secret,
+	allHostnames map[string]map[infranetworkv1.NetNameStr]string,
+	hosts []string,
+) []corev1.KeyToPath {
+	items := []corev1.KeyToPath{}
+	for _, host := range hosts {
+		baseName, ok := allHostnames[host][CtlPlaneNetwork]
+		if !ok {
+			continue
+		}
+		for _, file := range hostCertsFiles {
+			key := getHostCertsKey(baseName, file)
+			if _, ok := certsSecret.Data[key]; ok {
+				items = append(items, corev1.KeyToPath{Key: key, Path: key})
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Key < items[j].Key
+	})
+
+	return items
+}
+
+// GetServiceCertsStatusKey - return the key under which the certs secrets of a service
+// cert are recorded in the ServiceCertSecrets status field of the nodeset.
+// The convention we use here is "<service>/<certkey>", for example, nova/default.
+func GetServiceCertsStatusKey(serviceName string, certKey string) string {
+	return fmt.Sprintf("%s/%s", serviceName, certKey)
+}
@@ -71,4 +71,28 @@ const (
 
 	//HostnameLabel label for marking secrets to be watched for changes
 	HostnameLabel = "hostname"
+
+	// NodeRemovalLabel label for marking the deployments removing a node
+	NodeRemovalLabel = "osdp-node-removal"
+
+	// NodeReplacementLabel label for marking the deployments replacing a node
+	NodeReplacementLabel = "osdp-node-replacement"
+
+	// preHookStage for the hooks run before a service
+	preHookStage = "pre"
+
+	// postHookStage for the hooks run after a service
+	postHookStage = "post"
+
+	// TrustedCABundleConfigMap name of the ConfigMap holding the cluster trusted CA bundle
+	TrustedCABundleConfigMap = "dataplane-trusted-ca-bundle"
+
+	// TrustedCABundleInjectLabel label requesting the injection of the cluster trusted CA bundle
+	TrustedCABundleInjectLabel = "config.openshift.io/inject-trusted-cabundle"
+
+	// TrustedCABundleKey key of the cluster trusted CA bundle in its ConfigMap
+	TrustedCABundleKey = "ca-bundle.crt"
+
+	// InstallCertsService name of the service installing the TLS certs on the nodes
+	InstallCertsService = "install-certs"
 )
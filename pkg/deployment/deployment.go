@@ -23,11 +23,14 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"time"
 
 	slices "golang.org/x/exp/slices"
 	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/iancoleman/strcase"
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
@@ -65,14 +68,20 @@ func (d *Deployer) Deploy(services []string) (*ctrl.Result, error) {
 	var readyErrorMessage string
 	var deployName string
 
+	if d.Deployment.Spec.HealthCheckOnly {
+		return d.checkServicesHealth(services)
+	}
+
 	// Save a copy of the original ExtraMounts so it can be reset after each
 	// service deployment
 	aeeSpecMounts := make([]storage.VolMounts, len(d.AeeSpec.ExtraMounts))
 	copy(aeeSpecMounts, d.AeeSpec.ExtraMounts)
+	// Same for the AnsibleLimit, restricted by the hostSelector of the services
+	ansibleLimit := d.AeeSpec.AnsibleLimit
 	// Deploy the composable services
 	for _, service := range services {
 		deployName = service
-		readyCondition = condition.Type(fmt.Sprintf("Service%sDeploymentReady", strcase.ToCamel(service)))
+		readyCondition = GetServiceDeploymentReadyCondition(service)
 		readyWaitingMessage = fmt.Sprintf(dataplanev1.NodeSetServiceDeploymentReadyWaitingMessage, deployName)
 		readyMessage = fmt.Sprintf(dataplanev1.NodeSetServiceDeploymentReadyMessage, deployName)
 		readyErrorMessage = fmt.Sprintf(dataplanev1.NodeSetServiceDeploymentErrorMessage, deployName) + " error %s"
@@ -80,6 +89,13 @@ func (d *Deployer) Deploy(services []string) (*ctrl.Result, error) {
 		nsConditions := d.Status.NodeSetConditions[d.NodeSet.Name]
 		log.Info("Deploying service", "service", service)
 		foundService, err := GetService(d.Ctx, d.Helper, service)
+		if err == nil {
+			err = d.setServiceAeeSpec(foundService, services, aeeSpecMounts)
+		}
+		hasHosts := false
+		if err == nil {
+			hasHosts, err = d.setServiceAnsibleLimit(foundService, ansibleLimit)
+		}
 		if err != nil {
 			nsConditions.Set(condition.FalseCondition(
 				readyCondition,
@@ -90,46 +106,21 @@ func (d *Deployer) Deploy(services []string) (*ctrl.Result, error) {
 			d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
 			return &ctrl.Result{}, err
 		}
-
-		containerImages := dataplaneutil.GetContainerImages(d.Version)
-		if containerImages.AnsibleeeImage != nil {
-			d.AeeSpec.OpenStackAnsibleEERunnerImage = *containerImages.AnsibleeeImage
-		}
-		if len(foundService.Spec.OpenStackAnsibleEERunnerImage) > 0 {
-			d.AeeSpec.OpenStackAnsibleEERunnerImage = foundService.Spec.OpenStackAnsibleEERunnerImage
-		}
-
-		// Reset ExtraMounts to its original value, and then add in service
-		// specific mounts.
-		d.AeeSpec.ExtraMounts = make([]storage.VolMounts, len(aeeSpecMounts))
-		copy(d.AeeSpec.ExtraMounts, aeeSpecMounts)
-		d.AeeSpec, err = d.addServiceExtraMounts(foundService)
-		if err != nil {
-			nsConditions.Set(condition.FalseCondition(
+		if !hasHosts {
+			log.Info("Skipping service, no node matches its hostSelector", "service", service)
+			skippedCondition := condition.TrueCondition(
 				readyCondition,
-				condition.ErrorReason,
-				condition.SeverityError,
-				readyErrorMessage,
-				err.Error()))
+				dataplanev1.NodeSetServiceDeploymentSkippedMessage,
+				deployName)
+			skippedCondition.Reason = dataplanev1.SkippedReason
+			nsConditions.Set(skippedCondition)
 			d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
-			return &ctrl.Result{}, err
+			continue
 		}
 
-		// Add certMounts if TLS is enabled
-		if d.NodeSet.Spec.TLSEnabled {
-			if foundService.Spec.AddCertMounts {
-				d.AeeSpec, err = d.addCertMounts(services)
-			}
-			if err != nil {
-				nsConditions.Set(condition.FalseCondition(
-					readyCondition,
-					condition.ErrorReason,
-					condition.SeverityError,
-					readyErrorMessage,
-					err.Error()))
-				d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
-				return &ctrl.Result{}, err
-			}
+		hooksReady, err := d.deployServiceHooks(foundService, preHookStage, foundService.Spec.PreHooks)
+		if err != nil || !hooksReady {
+			return &ctrl.Result{RequeueAfter: d.getRequeueAfter(foundService)}, err
 		}
 
 		err = d.ConditionalDeploy(
@@ -144,11 +135,41 @@ func (d *Deployer) Deploy(services []string) (*ctrl.Result, error) {
 		nsConditions = d.Status.NodeSetConditions[d.NodeSet.Name]
 		if err != nil || !nsConditions.IsTrue(readyCondition) {
 			log.Info(fmt.Sprintf("Condition %s not ready", readyCondition))
-			return &ctrl.Result{}, err
+			return &ctrl.Result{RequeueAfter: d.getRequeueAfter(foundService)}, err
+		}
+
+		// The service is only ready once its health check passes
+		if foundService.Spec.HealthCheck != nil {
+			healthy, requeueAfter, err := d.checkServiceHealth(foundService)
+			if err != nil || !healthy {
+				nsConditions = d.Status.NodeSetConditions[d.NodeSet.Name]
+				if err != nil {
+					nsConditions.Set(condition.FalseCondition(
+						readyCondition,
+						condition.ErrorReason,
+						condition.SeverityError,
+						readyErrorMessage,
+						err.Error()))
+				} else {
+					nsConditions.Set(condition.FalseCondition(
+						readyCondition,
+						condition.RequestedReason,
+						condition.SeverityInfo,
+						readyWaitingMessage))
+				}
+				d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
+				log.Info(fmt.Sprintf("Condition %s not ready, waiting for the health check", readyCondition))
+				return &ctrl.Result{RequeueAfter: requeueAfter}, err
+			}
 		}
 
 		log.Info(fmt.Sprintf("Condition %s ready", readyCondition))
 
+		hooksReady, err = d.deployServiceHooks(foundService, postHookStage, foundService.Spec.PostHooks)
+		if err != nil || !hooksReady {
+			return &ctrl.Result{RequeueAfter: d.getRequeueAfter(foundService)}, err
+		}
+
 		// (TODO) Only considers the container image values from the Version
 		// for the time being. Can be expanded later to look at the actual
 		// values used from the inventory, etc.
@@ -164,6 +185,152 @@ func (d *Deployer) Deploy(services []string) (*ctrl.Result, error) {
 	return nil, nil
 }
 
+// setServiceAeeSpec sets the runner image and the extra mounts of the ansible
+// executions of a service, which can't have a runnerPodTemplate yet
+func (d *Deployer) setServiceAeeSpec(
+	foundService dataplanev1.OpenStackDataPlaneService,
+	services []string,
+	aeeSpecMounts []storage.VolMounts,
+) error {
+	var err error
+
+	containerImages := dataplaneutil.GetContainerImages(d.Version)
+	if containerImages.AnsibleeeImage != nil {
+		d.AeeSpec.OpenStackAnsibleEERunnerImage = *containerImages.AnsibleeeImage
+	}
+	if len(foundService.Spec.OpenStackAnsibleEERunnerImage) > 0 {
+		d.AeeSpec.OpenStackAnsibleEERunnerImage = foundService.Spec.OpenStackAnsibleEERunnerImage
+	}
+
+	// The OpenStackAnsibleEE API has no fields to pass the runner pod
+	// settings to yet, fail instead of ignoring them
+	if getRunnerPodTemplate(d.NodeSet, foundService) != nil {
+		return fmt.Errorf(dataplanev1.NodeSetServiceRunnerPodTemplateUnsupportedMessage, foundService.Name)
+	}
+
+	// Reset ExtraMounts to its original value, and then add in service
+	// specific mounts.
+	d.AeeSpec.ExtraMounts = make([]storage.VolMounts, len(aeeSpecMounts))
+	copy(d.AeeSpec.ExtraMounts, aeeSpecMounts)
+	d.AeeSpec, err = d.addServiceExtraMounts(foundService)
+	if err != nil {
+		return err
+	}
+
+	// Add certMounts if TLS is enabled
+	if d.NodeSet.Spec.TLSEnabled && foundService.Spec.AddCertMounts {
+		d.AeeSpec, err = d.addCertMounts(getCertMountServices(foundService, services))
+	}
+
+	return err
+}
+
+// getRunnerPodTemplate returns the runner pod settings of the ansible executions
+// of a service. The runnerPodTemplate of the service replaces the one of the
+// NodeSet.
+func getRunnerPodTemplate(
+	nodeSet *dataplanev1.OpenStackDataPlaneNodeSet,
+	service dataplanev1.OpenStackDataPlaneService,
+) *dataplanev1.RunnerPodTemplate {
+	if service.Spec.RunnerPodTemplate != nil {
+		return service.Spec.RunnerPodTemplate
+	}
+
+	return nodeSet.Spec.RunnerPodTemplate
+}
+
+// getActiveDeadline returns the time after which an execution of a service not
+// finished yet is stopped, or 0 when its executions have no deadline
+func (d *Deployer) getActiveDeadline(service dataplanev1.OpenStackDataPlaneService) time.Duration {
+	activeDeadlineSeconds := d.Deployment.Spec.ActiveDeadlineSeconds
+	if service.Spec.ActiveDeadlineSeconds != nil {
+		activeDeadlineSeconds = service.Spec.ActiveDeadlineSeconds
+	}
+	if activeDeadlineSeconds == nil {
+		return 0
+	}
+
+	return time.Duration(*activeDeadlineSeconds) * time.Second
+}
+
+// getRequeueAfter returns when to check again the executions of a service not
+// finished yet. The executions with a deadline are polled, as a hung execution
+// doesn't trigger a reconcile once it exceeds its deadline.
+func (d *Deployer) getRequeueAfter(service dataplanev1.OpenStackDataPlaneService) time.Duration {
+	if d.getActiveDeadline(service) == 0 {
+		return 0
+	}
+
+	return time.Duration(d.Deployment.Spec.DeploymentRequeueTime) * time.Second
+}
+
+// GetServiceDeploymentReadyCondition returns the condition tracking the
+// deployment of a service on a NodeSet
+func GetServiceDeploymentReadyCondition(service string) condition.Type {
+	return condition.Type(fmt.Sprintf("Service%sDeploymentReady", strcase.ToCamel(service)))
+}
+
+// deployServiceHooks runs the pre or post hooks of a service in order, each in
+// an ansible execution of its own, and returns whether they all succeeded
+func (d *Deployer) deployServiceHooks(
+	service dataplanev1.OpenStackDataPlaneService,
+	stage string,
+	hooks []dataplanev1.ServiceHook,
+) (bool, error) {
+	log := d.Helper.GetLogger()
+
+	for _, hook := range hooks {
+		readyCondition := GetServiceHookReadyCondition(service.Name, stage, hook.Name)
+		// The hooks running on the ansible runner target localhost
+		if hook.RunOn == dataplanev1.ServiceHookRunOnRunner {
+			d.AeeSpec.OverrideHosts = "localhost"
+		}
+		err := d.ConditionalDeploy(
+			readyCondition,
+			fmt.Sprintf(dataplanev1.NodeSetServiceHookReadyMessage, stage, hook.Name, service.Name),
+			fmt.Sprintf(dataplanev1.NodeSetServiceHookReadyWaitingMessage, stage, hook.Name, service.Name),
+			fmt.Sprintf(dataplanev1.NodeSetServiceHookErrorMessage, stage, hook.Name, service.Name)+" error %s",
+			fmt.Sprintf("%s hook %s of %s", stage, hook.Name, service.Name),
+			getServiceHookService(service, stage, hook),
+		)
+		d.AeeSpec.OverrideHosts = ""
+
+		nsConditions := d.Status.NodeSetConditions[d.NodeSet.Name]
+		if err != nil || !nsConditions.IsTrue(readyCondition) {
+			log.Info(fmt.Sprintf("Condition %s not ready", readyCondition))
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// GetServiceHookReadyCondition returns the condition tracking the execution
+// of a pre or post hook of a service on a NodeSet
+func GetServiceHookReadyCondition(service string, stage string, hook string) condition.Type {
+	return condition.Type(fmt.Sprintf("Service%s%sHook%sReady",
+		strcase.ToCamel(service), strcase.ToCamel(stage), strcase.ToCamel(hook)))
+}
+
+// getServiceHookService returns the service executed for a hook of a service.
+// It runs the playbook of the hook, with the mounts and the ansible vars of the
+// service.
+func getServiceHookService(
+	service dataplanev1.OpenStackDataPlaneService,
+	stage string,
+	hook dataplanev1.ServiceHook,
+) dataplanev1.OpenStackDataPlaneService {
+	hookService := *service.DeepCopy()
+	hookService.Name = fmt.Sprintf("%s-%s-%s", service.Name, stage, hook.Name)
+	hookService.Spec.Playbook = hook.Playbook
+	hookService.Spec.PlaybookContents = hook.PlaybookContents
+	if hookService.Spec.EDPMServiceType == "" {
+		hookService.Spec.EDPMServiceType = service.Name
+	}
+
+	return hookService
+}
+
 // ConditionalDeploy function encapsulating primary deloyment handling with
 // conditions.
 func (d *Deployer) ConditionalDeploy(
@@ -195,6 +362,13 @@ func (d *Deployer) ConditionalDeploy(
 	}
 
 	if nsConditions.IsFalse(readyCondition) {
+		// The execution that exceeded its deadline is deleted, keep reporting
+		// the timeout
+		if readyCond := nsConditions.Get(readyCondition); readyCond.Reason == dataplanev1.TimeoutReason {
+			log.Info(fmt.Sprintf("Condition %s timeout", readyCondition))
+			return fmt.Errorf("%s", readyCond.Message)
+		}
+
 		var ansibleEE *ansibleeev1.OpenStackAnsibleEE
 		_, labelSelector := dataplaneutil.GetAnsibleExecutionNameAndLabels(&foundService, d.Deployment.Name, d.NodeSet.Name)
 		ansibleEE, err = dataplaneutil.GetAnsibleExecution(d.Ctx, d.Helper, d.Deployment, labelSelector)
@@ -221,12 +395,31 @@ func (d *Deployer) ConditionalDeploy(
 		}
 
 		if ansibleEE.Status.JobStatus == ansibleeev1.JobStatusRunning || ansibleEE.Status.JobStatus == ansibleeev1.JobStatusPending {
-			log.Info(fmt.Sprintf("AnsibleEE job is not yet completed: Execution: %s, Status: %s", ansibleEE.Name, ansibleEE.Status.JobStatus))
-			nsConditions.Set(condition.FalseCondition(
-				readyCondition,
-				condition.RequestedReason,
-				condition.SeverityInfo,
-				readyWaitingMessage))
+			activeDeadline := d.getActiveDeadline(foundService)
+			if activeDeadline > 0 && time.Since(ansibleEE.CreationTimestamp.Time) > activeDeadline {
+				log.Info(fmt.Sprintf("Condition %s timeout", readyCondition))
+				err = fmt.Errorf(dataplanev1.NodeSetServiceDeploymentTimeoutMessage,
+					ansibleEE.Name, ansibleEE.Namespace, int64(activeDeadline.Seconds()))
+				// Delete the execution to stop its job
+				deleteErr := d.Helper.GetClient().Delete(d.Ctx, ansibleEE,
+					client.PropagationPolicy(metav1.DeletePropagationBackground))
+				if deleteErr != nil && !k8s_errors.IsNotFound(deleteErr) {
+					return deleteErr
+				}
+				nsConditions.Set(condition.FalseCondition(
+					readyCondition,
+					dataplanev1.TimeoutReason,
+					condition.SeverityError,
+					readyErrorMessage,
+					err.Error()))
+			} else {
+				log.Info(fmt.Sprintf("AnsibleEE job is not yet completed: Execution: %s, Status: %s", ansibleEE.Name, ansibleEE.Status.JobStatus))
+				nsConditions.Set(condition.FalseCondition(
+					readyCondition,
+					condition.RequestedReason,
+					condition.SeverityInfo,
+					readyWaitingMessage))
+			}
 		}
 
 		if ansibleEE.Status.JobStatus == ansibleeev1.JobStatusFailed {
@@ -250,19 +443,49 @@ func (d *Deployer) ConditionalDeploy(
 	return err
 }
 
+// getCertMountServices returns the services whose certs are mounted for a
+// service with addCertMounts set. A service with certs of its own, or using the
+// certs of another service, only mounts those certs. Otherwise, as for the
+// install-certs service, the certs of all the deployed services are mounted.
+func getCertMountServices(service dataplanev1.OpenStackDataPlaneService, services []string) []string {
+	if service.Spec.TLSCerts == nil && !HasCACerts(service) && service.Spec.CertsFrom == "" {
+		return services
+	}
+	certServices := []string{service.Name}
+	if service.Spec.CertsFrom != "" {
+		certServices = append(certServices, service.Spec.CertsFrom)
+	}
+
+	return certServices
+}
+
 // addCertMounts adds the cert mounts to the aeeSpec for the install-certs service
 func (d *Deployer) addCertMounts(
 	services []string,
 ) (*dataplanev1.AnsibleEESpec, error) {
 	log := d.Helper.GetLogger()
 	client := d.Helper.GetClient()
+
+	// only mount the certs of the hosts targeted by the execution, or of all
+	// the hosts when the limit can't be fully resolved against the NodeSet
+	targetedHosts, resolved, err := GetTargetedHosts(d.NodeSet, d.AeeSpec.AnsibleLimit)
+	if err != nil {
+		return d.AeeSpec, err
+	}
+	if !resolved {
+		targetedHosts, _, err = GetTargetedHosts(d.NodeSet, "")
+		if err != nil {
+			return d.AeeSpec, err
+		}
+	}
+
 	for _, svc := range services {
 		service, err := GetService(d.Ctx, d.Helper, svc)
 		if err != nil {
 			return nil, err
 		}
 
-		if service.Spec.CertsFrom != "" && service.Spec.TLSCerts == nil && service.Spec.CACerts == "" {
+		if service.Spec.CertsFrom != "" && service.Spec.TLSCerts == nil && !HasCACerts(service) {
 			if slices.Contains(services, service.Spec.CertsFrom) {
 				continue
 			}
@@ -281,36 +504,50 @@ func (d *Deployer) addCertMounts(
 			sort.Strings(certKeyList)
 
 			for _, certKey := range certKeyList {
-				log.Info("Mounting TLS cert for service", "service", svc)
 				volMounts := storage.VolMounts{}
 
 				// add mount for certs and keys
-				secretName := GetServiceCertsSecretName(d.NodeSet, service.Name, certKey, 0) // Need to get the number of secrets
-				certSecret := &corev1.Secret{}
-				err := client.Get(d.Ctx, types.NamespacedName{Name: secretName, Namespace: service.Namespace}, certSecret)
-				if err != nil {
-					return d.AeeSpec, err
+				certSecrets := d.NodeSet.Status.ServiceCertSecrets[GetServiceCertsStatusKey(service.Name, certKey)]
+				if len(certSecrets) == 0 {
+					return d.AeeSpec, fmt.Errorf("no certs secrets recorded for service %s and cert %s", service.Name, certKey)
 				}
-				numberOfSecrets, _ := strconv.Atoi(certSecret.Labels["numberOfSecrets"])
 				projectedVolumeSource := corev1.ProjectedVolumeSource{
 					Sources: []corev1.VolumeProjection{},
 				}
-				for i := 0; i < numberOfSecrets; i++ {
-					secretName := GetServiceCertsSecretName(d.NodeSet, service.Name, certKey, i)
-					certSecret := &corev1.Secret{}
-					err := client.Get(d.Ctx, types.NamespacedName{Name: secretName, Namespace: service.Namespace}, certSecret)
+				for _, certSecret := range certSecrets {
+					secretHosts := []string{}
+					for _, host := range certSecret.Hosts {
+						if slices.Contains(targetedHosts, host) {
+							secretHosts = append(secretHosts, host)
+						}
+					}
+					if len(secretHosts) == 0 {
+						continue
+					}
+					secretData := &corev1.Secret{}
+					err := client.Get(d.Ctx, types.NamespacedName{Name: certSecret.Name, Namespace: service.Namespace}, secretData)
 					if err != nil {
 						return d.AeeSpec, err
 					}
 					volumeProjection := corev1.VolumeProjection{
 						Secret: &corev1.SecretProjection{
 							LocalObjectReference: corev1.LocalObjectReference{
-								Name: secretName,
+								Name: certSecret.Name,
 							},
 						},
 					}
+					// only project the files of the targeted hosts when the
+					// secret also holds the certs of other hosts
+					if len(secretHosts) < len(certSecret.Hosts) {
+						volumeProjection.Secret.Items = getHostCertsItems(
+							secretData, d.NodeSet.Status.AllHostnames, secretHosts)
+					}
 					projectedVolumeSource.Sources = append(projectedVolumeSource.Sources, volumeProjection)
 				}
+				if len(projectedVolumeSource.Sources) == 0 {
+					continue
+				}
+				log.Info("Mounting TLS cert for service", "service", svc, "hosts", targetedHosts)
 				certVolume := corev1.Volume{
 					Name: GetServiceCertsSecretName(d.NodeSet, service.Name, certKey, 0),
 					VolumeSource: corev1.VolumeSource{
@@ -334,25 +571,26 @@ func (d *Deployer) addCertMounts(
 		}
 
 		// add mount for cacert bundle
-		if len(service.Spec.CACerts) > 0 {
+		if HasCACerts(service) {
 			log.Info("Mounting CA cert bundle for service", "service", svc)
 			volMounts := storage.VolMounts{}
+			caCertsSecretName := GetServiceCACertsSecretName(service)
 			cacertSecret := &corev1.Secret{}
-			err := client.Get(d.Ctx, types.NamespacedName{Name: service.Spec.CACerts, Namespace: service.Namespace}, cacertSecret)
+			err := client.Get(d.Ctx, types.NamespacedName{Name: caCertsSecretName, Namespace: service.Namespace}, cacertSecret)
 			if err != nil {
 				return d.AeeSpec, err
 			}
 			cacertVolume := corev1.Volume{
-				Name: fmt.Sprintf("%s-%s", service.Name, service.Spec.CACerts),
+				Name: fmt.Sprintf("%s-%s", service.Name, caCertsSecretName),
 				VolumeSource: corev1.VolumeSource{
 					Secret: &corev1.SecretVolumeSource{
-						SecretName: service.Spec.CACerts,
+						SecretName: caCertsSecretName,
 					},
 				},
 			}
 
 			cacertVolumeMount := corev1.VolumeMount{
-				Name:      fmt.Sprintf("%s-%s", service.Name, service.Spec.CACerts),
+				Name:      fmt.Sprintf("%s-%s", service.Name, caCertsSecretName),
 				MountPath: path.Join(CACertPaths, service.Spec.EDPMServiceType),
 			}
 
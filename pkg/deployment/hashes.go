@@ -24,6 +24,7 @@ import (
 	"github.com/openstack-k8s-operators/lib-common/modules/common/configmap"
 	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
 	"github.com/openstack-k8s-operators/lib-common/modules/common/secret"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/util"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
@@ -36,7 +37,9 @@ func GetDeploymentHashesForService(
 	serviceName string,
 	configMapHashes map[string]string,
 	secretHashes map[string]string,
+	ansibleVarsHashes map[string]string,
 	nodeSets dataplanev1.OpenStackDataPlaneNodeSetList,
+	servicesOverride []string,
 ) error {
 
 	namespacedName := types.NamespacedName{
@@ -50,7 +53,9 @@ func GetDeploymentHashesForService(
 		return err
 	}
 
-	for _, dataSource := range service.Spec.DataSources {
+	dataSources := append([]dataplanev1.DataSource{}, service.Spec.DataSources...)
+	dataSources = append(dataSources, service.Spec.AnsibleVarsFrom...)
+	for _, dataSource := range dataSources {
 		cm, sec, err := dataplaneutil.GetDataSourceCmSecret(ctx, helper, namespace, dataSource)
 		if err != nil {
 			return err
@@ -70,6 +75,16 @@ func GetDeploymentHashesForService(
 		}
 	}
 
+	// The inline ansibleVars of the service have no ConfigMap of their own,
+	// their hash is recorded under the name of the service
+	if len(service.Spec.AnsibleVars) > 0 {
+		ansibleVarsHashes[serviceName], err = util.ObjectHash(service.Spec.AnsibleVars)
+		if err != nil {
+			helper.GetLogger().Error(err, "Unable to hash the ansibleVars of the service %v")
+			return err
+		}
+	}
+
 	for _, cmName := range service.Spec.ConfigMaps {
 		namespacedName := types.NamespacedName{
 			Name:      cmName,
@@ -104,6 +119,20 @@ func GetDeploymentHashesForService(
 		}
 	}
 
+	if len(service.Spec.CACertsFrom) > 0 && hasCACertsBundle(serviceName, nodeSets, servicesOverride) {
+		caCertsSecretName := GetServiceCACertsSecretName(*service)
+		sec, _, err := secret.GetSecret(ctx, helper, caCertsSecretName, namespace)
+		if err != nil {
+			helper.GetLogger().Error(err, "Unable to retrieve CA bundle Secret %v")
+			return err
+		}
+		secretHashes[caCertsSecretName], err = secret.Hash(sec)
+		if err != nil {
+			helper.GetLogger().Error(err, "Unable to hash CA bundle Secret %v")
+			return err
+		}
+	}
+
 	if service.Spec.TLSCerts != nil {
 		for certKey := range service.Spec.TLSCerts {
 			var secrets *corev1.SecretList
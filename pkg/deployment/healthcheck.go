@@ -0,0 +1,229 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	dataplaneutil "github.com/openstack-k8s-operators/dataplane-operator/pkg/util"
+	condition "github.com/openstack-k8s-operators/lib-common/modules/common/condition"
+	"github.com/openstack-k8s-operators/lib-common/modules/storage"
+	ansibleeev1 "github.com/openstack-k8s-operators/openstack-ansibleee-operator/api/v1beta1"
+)
+
+// GetServiceHealthCheckReadyCondition returns the condition tracking the health
+// check of a service on a NodeSet
+func GetServiceHealthCheckReadyCondition(service string) condition.Type {
+	return condition.Type(fmt.Sprintf("Service%sHealthCheckReady", strcase.ToCamel(service)))
+}
+
+// getServiceHealthCheckService returns the service executed for an attempt of
+// the health check of a service. It runs the playbook of the health check, with
+// the mounts and the ansible vars of the service.
+func getServiceHealthCheckService(
+	service dataplanev1.OpenStackDataPlaneService,
+	attempt int32,
+) dataplanev1.OpenStackDataPlaneService {
+	healthCheckService := *service.DeepCopy()
+	healthCheckService.Name = fmt.Sprintf("%s-health-%d", service.Name, attempt)
+	healthCheckService.Spec.Playbook = service.Spec.HealthCheck.Playbook
+	healthCheckService.Spec.PlaybookContents = service.Spec.HealthCheck.PlaybookContents
+	if healthCheckService.Spec.EDPMServiceType == "" {
+		healthCheckService.Spec.EDPMServiceType = service.Name
+	}
+
+	return healthCheckService
+}
+
+// checkServiceHealth runs the health check of a service, and runs it again
+// after a failure up to its number of retries. It returns whether the health
+// check passed, and when to check it again while it is not finished.
+func (d *Deployer) checkServiceHealth(
+	service dataplanev1.OpenStackDataPlaneService,
+) (bool, time.Duration, error) {
+	log := d.Helper.GetLogger()
+	healthCheck := service.Spec.HealthCheck
+	readyCondition := GetServiceHealthCheckReadyCondition(service.Name)
+	interval := time.Duration(healthCheck.Interval) * time.Second
+	timeout := time.Duration(healthCheck.Timeout) * time.Second
+
+	nsConditions := d.Status.NodeSetConditions[d.NodeSet.Name]
+	if nsConditions.IsTrue(readyCondition) {
+		return true, 0, nil
+	}
+	// The execution of the last attempt is deleted when it times out, keep
+	// reporting the failure
+	if readyCond := nsConditions.Get(readyCondition); readyCond != nil && readyCond.Reason == condition.ErrorReason {
+		return false, 0, fmt.Errorf("%s", readyCond.Message)
+	}
+
+	// Each attempt of the health check runs in an ansible execution of its
+	// own, find the last one. The executions of the attempts that timed out
+	// are deleted.
+	var ansibleEE *ansibleeev1.OpenStackAnsibleEE
+	attempt := int32(0)
+	for i := int32(1); i <= healthCheck.Retries+1; i++ {
+		attemptService := getServiceHealthCheckService(service, i)
+		_, labelSelector := dataplaneutil.GetAnsibleExecutionNameAndLabels(&attemptService, d.Deployment.Name, d.NodeSet.Name)
+		attemptAnsibleEE, err := dataplaneutil.GetAnsibleExecution(d.Ctx, d.Helper, d.Deployment, labelSelector)
+		if k8s_errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, 0, err
+		}
+		ansibleEE = attemptAnsibleEE
+		attempt = i
+	}
+
+	var requeueAfter time.Duration
+	var failure string
+	if ansibleEE != nil {
+		switch ansibleEE.Status.JobStatus {
+		case ansibleeev1.JobStatusSucceeded:
+			log.Info(fmt.Sprintf("Condition %s ready", readyCondition))
+			nsConditions.Set(condition.TrueCondition(
+				readyCondition,
+				dataplanev1.NodeSetServiceHealthCheckReadyMessage,
+				service.Name))
+			d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
+			return true, 0, nil
+		case ansibleeev1.JobStatusFailed:
+			failure = fmt.Sprintf("execution.name %s execution.namespace %s execution.status.jobstatus: %s",
+				ansibleEE.Name, ansibleEE.Namespace, ansibleEE.Status.JobStatus)
+			finished := ansibleEE.CreationTimestamp.Time
+			if ansibleCondition := ansibleEE.Status.Conditions.Get(condition.ReadyCondition); ansibleCondition != nil {
+				finished = ansibleCondition.LastTransitionTime.Time
+			}
+			requeueAfter = time.Until(finished.Add(interval))
+		default:
+			if timeout > 0 {
+				deadline := ansibleEE.CreationTimestamp.Add(timeout)
+				if time.Now().After(deadline) {
+					failure = fmt.Sprintf("execution.name %s execution.namespace %s timed out after %s",
+						ansibleEE.Name, ansibleEE.Namespace, timeout)
+					// Delete the execution to stop its job, the next attempt
+					// runs right away
+					err := d.Helper.GetClient().Delete(d.Ctx, ansibleEE,
+						client.PropagationPolicy(metav1.DeletePropagationBackground))
+					if err != nil && !k8s_errors.IsNotFound(err) {
+						return false, 0, err
+					}
+				} else {
+					requeueAfter = time.Until(deadline)
+				}
+			}
+		}
+	}
+
+	if failure != "" && attempt > healthCheck.Retries {
+		log.Info(fmt.Sprintf("Condition %s error", readyCondition))
+		err := fmt.Errorf("health check of service %s failed after %d attempts: %s", service.Name, attempt, failure)
+		nsConditions.Set(condition.FalseCondition(
+			readyCondition,
+			condition.ErrorReason,
+			condition.SeverityError,
+			dataplanev1.NodeSetServiceHealthCheckErrorMessage+" error %s",
+			service.Name,
+			err.Error()))
+		d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
+		return false, 0, err
+	}
+
+	if ansibleEE == nil || (failure != "" && requeueAfter <= 0) {
+		attempt++
+		log.Info("Running the health check of service", "service", service.Name, "attempt", attempt)
+		err := d.DeployService(getServiceHealthCheckService(service, attempt))
+		if err != nil {
+			return false, 0, err
+		}
+		requeueAfter = timeout
+	}
+
+	nsConditions.Set(condition.FalseCondition(
+		readyCondition,
+		condition.RequestedReason,
+		condition.SeverityInfo,
+		dataplanev1.NodeSetServiceHealthCheckReadyWaitingMessage,
+		service.Name,
+		attempt,
+		healthCheck.Retries+1))
+	d.Status.NodeSetConditions[d.NodeSet.Name] = nsConditions
+
+	return false, requeueAfter, nil
+}
+
+// checkServicesHealth only runs the health checks of the services, to report
+// the health of the NodeSet in the conditions of the deployment. All the
+// health checks run, even when some of them fail.
+func (d *Deployer) checkServicesHealth(services []string) (*ctrl.Result, error) {
+	var requeueAfter time.Duration
+	isPending := false
+	failures := []string{}
+
+	aeeSpecMounts := make([]storage.VolMounts, len(d.AeeSpec.ExtraMounts))
+	copy(aeeSpecMounts, d.AeeSpec.ExtraMounts)
+	ansibleLimit := d.AeeSpec.AnsibleLimit
+	for _, service := range services {
+		foundService, err := GetService(d.Ctx, d.Helper, service)
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+		if foundService.Spec.HealthCheck == nil {
+			continue
+		}
+		err = d.setServiceAeeSpec(foundService, services, aeeSpecMounts)
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+		// The health check of a service is skipped along with the service
+		hasHosts, err := d.setServiceAnsibleLimit(foundService, ansibleLimit)
+		if err != nil {
+			return &ctrl.Result{}, err
+		}
+		if !hasHosts {
+			continue
+		}
+
+		healthy, serviceRequeueAfter, err := d.checkServiceHealth(foundService)
+		if err != nil {
+			failures = append(failures, err.Error())
+		} else if !healthy {
+			isPending = true
+			if serviceRequeueAfter > 0 && (requeueAfter == 0 || serviceRequeueAfter < requeueAfter) {
+				requeueAfter = serviceRequeueAfter
+			}
+		}
+	}
+
+	if isPending {
+		return &ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	if len(failures) != 0 {
+		return &ctrl.Result{}, fmt.Errorf("%s", strings.Join(failures, ", "))
+	}
+
+	return nil, nil
+}
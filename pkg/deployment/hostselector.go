@@ -0,0 +1,128 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+)
+
+// getServiceHosts returns the inventory host names of the nodes of a NodeSet
+// matching the hostSelector of a service, and targeted by the ansibleLimit of
+// the deployment
+func getServiceHosts(
+	nodeSet *dataplanev1.OpenStackDataPlaneNodeSet,
+	hostSelector *dataplanev1.ServiceHostSelector,
+	ansibleLimit string,
+) ([]string, error) {
+	labelSelector := labels.Everything()
+	if hostSelector.Labels != nil {
+		var err error
+		labelSelector, err = metav1.LabelSelectorAsSelector(hostSelector.Labels)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The targeted hosts are the full host names of the nodes, while the
+	// inventory host names are the short ones
+	targetedHosts, _, err := GetTargetedHosts(nodeSet, ansibleLimit)
+	if err != nil {
+		return nil, err
+	}
+	isTargeted := map[string]bool{}
+	for _, hostName := range targetedHosts {
+		isTargeted[hostName] = true
+	}
+
+	hosts := []string{}
+	for _, node := range nodeSet.Spec.Nodes {
+		if !isTargeted[node.HostName] || !labelSelector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		matches, err := matchesAnsibleVars(nodeSet, node, hostSelector.AnsibleVars)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			hosts = append(hosts, strings.Split(node.HostName, ".")[0])
+		}
+	}
+	sort.Strings(hosts)
+
+	return hosts, nil
+}
+
+// matchesAnsibleVars returns whether a node has all the ansible vars, with
+// their values. The ansibleVars of the node override the ansibleVars of the
+// nodeTemplate.
+func matchesAnsibleVars(
+	nodeSet *dataplanev1.OpenStackDataPlaneNodeSet,
+	node dataplanev1.NodeSection,
+	ansibleVars map[string]string,
+) (bool, error) {
+	for key, value := range ansibleVars {
+		rawValue, ok := node.Ansible.AnsibleVars[key]
+		if !ok {
+			rawValue, ok = nodeSet.Spec.NodeTemplate.Ansible.AnsibleVars[key]
+		}
+		if !ok {
+			return false, nil
+		}
+		var nodeValue interface{}
+		err := yaml.Unmarshal(rawValue, &nodeValue)
+		if err != nil {
+			return false, err
+		}
+		if fmt.Sprint(nodeValue) != value {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// setServiceAnsibleLimit limits the ansible executions of a service with a
+// hostSelector to the matching nodes of the NodeSet. It returns false when no
+// node matches, and the service is skipped.
+func (d *Deployer) setServiceAnsibleLimit(
+	service dataplanev1.OpenStackDataPlaneService,
+	ansibleLimit string,
+) (bool, error) {
+	d.AeeSpec.AnsibleLimit = ansibleLimit
+	if service.Spec.HostSelector == nil {
+		return true, nil
+	}
+
+	hosts, err := getServiceHosts(d.NodeSet, service.Spec.HostSelector, ansibleLimit)
+	if err != nil {
+		return false, err
+	}
+	if len(hosts) == 0 {
+		return false, nil
+	}
+	d.AeeSpec.AnsibleLimit = strings.Join(hosts, ",")
+
+	return true, nil
+}
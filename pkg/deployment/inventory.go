@@ -25,6 +25,8 @@ import (
 	"strings"
 
 	yaml "gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
 	"github.com/openstack-k8s-operators/dataplane-operator/pkg/util"
@@ -72,11 +74,57 @@ func getAnsibleVarsFrom(ctx context.Context, helper *helper.Helper, namespace st
 	return result, nil
 }
 
-// GenerateNodeSetInventory yields a parsed Inventory for role
+// GenerateNodeSetInventory yields a parsed Inventory for role. The nodes in the
+// Removing state are left out of it, and are put in the separate inventory of
+// the removal deployments.
 func GenerateNodeSetInventory(ctx context.Context, helper *helper.Helper,
 	instance *dataplanev1.OpenStackDataPlaneNodeSet,
 	allIPSets map[string]infranetworkv1.IPSet, dnsAddresses []string,
 	containerImages openstackv1.ContainerImages) (string, error) {
+	secretName := GetInventorySecretName(instance)
+	invData, err := buildNodeSetInventory(ctx, helper, instance,
+		GetInventoryNodes(instance, false), allIPSets, dnsAddresses, containerImages)
+	if err != nil {
+		return secretName, err
+	}
+	err = ensureInventorySecret(ctx, helper, instance, secretName, invData)
+	if err != nil {
+		return secretName, err
+	}
+
+	// The teardown of the nodes runs against the inventory
+	inventorySecret := &corev1.Secret{}
+	err = helper.GetClient().Get(ctx, types.NamespacedName{Name: secretName, Namespace: instance.Namespace}, inventorySecret)
+	if err != nil {
+		return secretName, err
+	}
+	err = AddTeardownFinalizer(ctx, helper, inventorySecret)
+	if err != nil {
+		return secretName, err
+	}
+
+	removalNodes := GetInventoryNodes(instance, true)
+	if len(removalNodes) == 0 {
+		_, err = deleteOwnedObject(ctx, helper, instance,
+			&corev1.Secret{}, GetRemovalInventorySecretName(instance))
+		return secretName, err
+	}
+	invData, err = buildNodeSetInventory(ctx, helper, instance,
+		removalNodes, allIPSets, dnsAddresses, containerImages)
+	if err != nil {
+		return secretName, err
+	}
+	err = ensureInventorySecret(ctx, helper, instance, GetRemovalInventorySecretName(instance), invData)
+	return secretName, err
+}
+
+// buildNodeSetInventory returns the Ansible inventory of a set of nodes of a
+// NodeSet
+func buildNodeSetInventory(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+	nodes map[string]dataplanev1.NodeSection,
+	allIPSets map[string]infranetworkv1.IPSet, dnsAddresses []string,
+	containerImages openstackv1.ContainerImages) (string, error) {
 	inventory := ansible.MakeInventory()
 	nodeSetGroup := inventory.AddGroup(instance.Name)
 	groupVars, err := getAnsibleVarsFrom(ctx, helper, instance.Namespace, &instance.Spec.NodeTemplate.Ansible)
@@ -105,9 +153,19 @@ func GenerateNodeSetInventory(ctx context.Context, helper *helper.Helper,
 	// add services list
 	nodeSetGroup.Vars["edpm_services"] = instance.Spec.Services
 
+	// add the hostnames and IPs of the nodes of the NodeSet, and of all the
+	// NodeSets of the namespace
+	nodeSetGroup.Vars["edpm_nodeset_topology"] = getNodeSetTopology(instance)
+	nodeSetsTopology, err := getNodeSetsTopology(ctx, helper, instance)
+	if err != nil {
+		utils.LogErrorForObject(helper, err, "could not get the topology of the NodeSets", instance)
+		return "", err
+	}
+	nodeSetGroup.Vars["edpm_nodesets_topology"] = nodeSetsTopology
+
 	nodeSetGroup.Vars["ansible_ssh_private_key_file"] = fmt.Sprintf("/runner/env/ssh_key/ssh_key_%s", instance.Name)
 
-	for _, node := range instance.Spec.Nodes {
+	for _, node := range nodes {
 		host := nodeSetGroup.AddHost(strings.Split(node.HostName, ".")[0])
 		hostVars, err := getAnsibleVarsFrom(ctx, helper, instance.Namespace, &node.Ansible)
 		if err != nil {
@@ -133,7 +191,11 @@ func GenerateNodeSetInventory(ctx context.Context, helper *helper.Helper,
 
 		ipSet, ok := allIPSets[node.HostName]
 		if ok {
-			populateInventoryFromIPAM(&ipSet, host, dnsAddresses, node.HostName)
+			err = populateInventoryFromIPAM(&ipSet, host, dnsAddresses, node.HostName)
+			if err != nil {
+				utils.LogErrorForObject(helper, err, "Could not populate the IPAM host vars", instance)
+				return "", err
+			}
 		}
 
 	}
@@ -143,10 +205,17 @@ func GenerateNodeSetInventory(ctx context.Context, helper *helper.Helper,
 		utils.LogErrorForObject(helper, err, "Could not parse NodeSet inventory", instance)
 		return "", err
 	}
+	return string(invData), nil
+}
+
+// ensureInventorySecret creates or updates a secret holding an Ansible
+// inventory of a NodeSet
+func ensureInventorySecret(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, secretName string, invData string,
+) error {
 	secretData := map[string]string{
-		"inventory": string(invData),
+		"inventory": invData,
 	}
-	secretName := fmt.Sprintf("dataplanenodeset-%s", instance.Name)
 	labels := map[string]string{
 		"openstack.org/operator-name": "dataplane",
 		"openstackdataplanenodeset":   instance.Name,
@@ -166,30 +235,81 @@ func GenerateNodeSetInventory(ctx context.Context, helper *helper.Helper,
 			Labels:       labels,
 		},
 	}
-	err = secret.EnsureSecrets(ctx, helper, instance, template, nil)
-	return secretName, err
+	return secret.EnsureSecrets(ctx, helper, instance, template, nil)
+}
+
+// GetInventorySecretName returns the name of the secret holding the Ansible
+// inventory of a NodeSet
+func GetInventorySecretName(instance *dataplanev1.OpenStackDataPlaneNodeSet) string {
+	return fmt.Sprintf("dataplanenodeset-%s", instance.Name)
 }
 
-// populateInventoryFromIPAM populates inventory from IPAM
+// GetRemovalInventorySecretName returns the name of the secret holding the
+// Ansible inventory of the nodes of a NodeSet in the Removing state
+func GetRemovalInventorySecretName(instance *dataplanev1.OpenStackDataPlaneNodeSet) string {
+	return fmt.Sprintf("dataplanenodeset-%s-removal", instance.Name)
+}
+
+// populateInventoryFromIPAM populates inventory from IPAM. The <net>_ip,
+// <net>_cidr and <net>_gateway_ip vars hold the IPv4 address of a dual-stack
+// network, while the <net>_ipv4* and <net>_ipv6* vars hold the address of each
+// family and <net>_ips lists all the addresses of the node on the network.
 func populateInventoryFromIPAM(
 	ipSet *infranetworkv1.IPSet, host ansible.Host,
-	dnsAddresses []string, hostName string) {
+	dnsAddresses []string, hostName string) error {
 	var dnsSearchDomains []string
+	primary := getPrimaryReservations(ipSet)
+	// The networks whose list vars are set by the reservations, the vars
+	// of the other networks may come from the ansibleVars of the node
+	networks := map[string]bool{}
 	for _, res := range ipSet.Status.Reservation {
 		// Build the vars for ips/routes etc
 		entry := strings.ToLower(string(res.Network))
-		host.Vars[entry+"_ip"] = res.Address
-		_, ipnet, err := net.ParseCIDR(res.Cidr)
-		if err == nil {
-			netCidr, _ := ipnet.Mask.Size()
-			host.Vars[entry+"_cidr"] = netCidr
+		family := "ipv4"
+		if isIPv6Address(res.Address) {
+			family = "ipv6"
+		}
+		var netCidr int
+		_, ipnet, cidrErr := net.ParseCIDR(res.Cidr)
+		if cidrErr == nil {
+			netCidr, _ = ipnet.Mask.Size()
+		}
+
+		if !networks[entry] {
+			networks[entry] = true
+			host.Vars[entry+"_ips"] = []string{}
+			host.Vars[entry+"_host_routes"] = res.Routes
+		} else if len(res.Routes) > 0 {
+			routes, ok := host.Vars[entry+"_host_routes"].([]infranetworkv1.Route)
+			if !ok {
+				return fmt.Errorf("unexpected type %T of the %s_host_routes var of %s",
+					host.Vars[entry+"_host_routes"], entry, hostName)
+			}
+			host.Vars[entry+"_host_routes"] = append(routes, res.Routes...)
+		}
+		ips, ok := host.Vars[entry+"_ips"].([]string)
+		if !ok {
+			return fmt.Errorf("unexpected type %T of the %s_ips var of %s",
+				host.Vars[entry+"_ips"], entry, hostName)
+		}
+		host.Vars[entry+"_ips"] = append(ips, res.Address)
+		host.Vars[entry+"_"+family] = res.Address
+		if cidrErr == nil {
+			host.Vars[entry+"_"+family+"_cidr"] = netCidr
+		}
+		host.Vars[entry+"_"+family+"_gateway_ip"] = res.Gateway
+
+		if primary[entry].Address == res.Address {
+			host.Vars[entry+"_ip"] = res.Address
+			if cidrErr == nil {
+				host.Vars[entry+"_cidr"] = netCidr
+			}
+			host.Vars[entry+"_gateway_ip"] = res.Gateway
 		}
 		if res.Vlan != nil || entry != CtlPlaneNetwork {
 			host.Vars[entry+"_vlan_id"] = res.Vlan
 		}
 		host.Vars[entry+"_mtu"] = res.MTU
-		host.Vars[entry+"_gateway_ip"] = res.Gateway
-		host.Vars[entry+"_host_routes"] = res.Routes
 
 		if entry == CtlPlaneNetwork {
 			host.Vars[entry+"_dns_nameservers"] = dnsAddresses
@@ -197,15 +317,27 @@ func populateInventoryFromIPAM(
 				host.Vars["canonical_hostname"] = hostName
 				domain := strings.SplitN(hostName, ".", 2)[1]
 				if domain != res.DNSDomain {
-					dnsSearchDomains = append(dnsSearchDomains, domain)
+					dnsSearchDomains = appendUnique(dnsSearchDomains, domain)
 				}
 			} else {
 				host.Vars["canonical_hostname"] = strings.Join([]string{hostName, res.DNSDomain}, ".")
 			}
 		}
-		dnsSearchDomains = append(dnsSearchDomains, res.DNSDomain)
+		dnsSearchDomains = appendUnique(dnsSearchDomains, res.DNSDomain)
 	}
 	host.Vars["dns_search_domains"] = dnsSearchDomains
+
+	return nil
+}
+
+// appendUnique appends a value to a slice when it is not already in it
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
 }
 
 // set group ansible vars from NodeTemplate
@@ -20,10 +20,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"sort"
 	"strings"
 
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
@@ -46,26 +49,54 @@ type DNSDetails struct {
 	CtlplaneSearchDomain string
 	// Hostnames is a map of hostnames provided by the NodeSet to the FQDNs
 	Hostnames map[string]map[infranetworkv1.NetNameStr]string
-	// AllIPs holds a map of all IP addresses per hostname.
+	// DNSAliases is a map of hostnames provided by the NodeSet to the sorted
+	// FQDNs of their DNS aliases on each network
+	DNSAliases map[string]map[infranetworkv1.NetNameStr][]string
+	// AllIPs holds a map of all IP addresses per hostname. On dual-stack
+	// networks, the IPv4 address is used.
 	AllIPs map[string]map[infranetworkv1.NetNameStr]string
+	// AllAddresses holds a map of the addresses of every IP family per
+	// hostname, in the order of the IPSet reservations
+	AllAddresses map[string]map[infranetworkv1.NetNameStr][]string
+	// DNSDataLabelSelectorValue is the DNSData label selector value of the DNSMasq
+	DNSDataLabelSelectorValue string
 }
 
-// checkDNSService checks if DNS is configured and ready
+// checkDNSService checks if DNS is configured and ready. The DNSMasq instance
+// is selected by the DNSMasqRef or DNSMasqSelector of the NodeSet, or is the
+// only instance of the namespace when neither is set.
 func checkDNSService(ctx context.Context, helper *helper.Helper,
-	instance client.Object, dnsDetails *DNSDetails,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, dnsDetails *DNSDetails,
 ) error {
 	dnsmasqList := &infranetworkv1.DNSMasqList{}
-	listOpts := []client.ListOption{
-		client.InNamespace(instance.GetNamespace()),
-	}
-	err := helper.GetClient().List(ctx, dnsmasqList, listOpts...)
-	if err != nil {
-		util.LogErrorForObject(helper, err, "Error listing dnsmasqs", instance)
-		return err
+	if instance.Spec.DNSMasqRef != "" {
+		dnsmasq := &infranetworkv1.DNSMasq{}
+		err := helper.GetClient().Get(ctx, types.NamespacedName{
+			Name:      instance.Spec.DNSMasqRef,
+			Namespace: instance.GetNamespace(),
+		}, dnsmasq)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			util.LogErrorForObject(helper, err, "Error getting dnsmasq", instance)
+			return err
+		} else if err == nil {
+			dnsmasqList.Items = append(dnsmasqList.Items, *dnsmasq)
+		}
+	} else {
+		listOpts := []client.ListOption{
+			client.InNamespace(instance.GetNamespace()),
+		}
+		if len(instance.Spec.DNSMasqSelector) > 0 {
+			listOpts = append(listOpts, client.MatchingLabels(instance.Spec.DNSMasqSelector))
+		}
+		err := helper.GetClient().List(ctx, dnsmasqList, listOpts...)
+		if err != nil {
+			util.LogErrorForObject(helper, err, "Error listing dnsmasqs", instance)
+			return err
+		}
 	}
 	if len(dnsmasqList.Items) > 1 {
-		util.LogForObject(helper, "Only one DNS control plane service can exist", instance)
-		err = errors.New(dataplanev1.NodeSetDNSDataMultipleDNSMasqErrorMessage)
+		util.LogForObject(helper, "Only one DNS control plane service can exist, unless dnsMasqRef or dnsMasqSelector selects one", instance)
+		err := errors.New(dataplanev1.NodeSetDNSDataMultipleDNSMasqErrorMessage)
 		return err
 	}
 	if len(dnsmasqList.Items) == 0 {
@@ -78,6 +109,7 @@ func checkDNSService(ctx context.Context, helper *helper.Helper,
 	}
 	dnsDetails.ClusterAddresses = dnsmasqList.Items[0].Status.DNSClusterAddresses
 	dnsDetails.ServerAddresses = dnsmasqList.Items[0].Status.DNSAddresses
+	dnsDetails.DNSDataLabelSelectorValue = dnsmasqList.Items[0].Spec.DNSDataLabelSelectorValue
 	return nil
 }
 
@@ -90,13 +122,15 @@ func createOrPatchDNSData(ctx context.Context, helper *helper.Helper,
 	var ctlplaneSearchDomain string
 	dnsDetails.Hostnames = map[string]map[infranetworkv1.NetNameStr]string{}
 	dnsDetails.AllIPs = map[string]map[infranetworkv1.NetNameStr]string{}
+	dnsDetails.AllAddresses = map[string]map[infranetworkv1.NetNameStr][]string{}
+	dnsDetails.DNSAliases = map[string]map[infranetworkv1.NetNameStr][]string{}
 
 	// Build DNSData CR
 	// We need to sort the nodes here, else DNSData.Spec.Hosts would change
 	// For every reconcile and it could create reconcile loops.
-	nodes := instance.Spec.Nodes
+	nodes := getActiveNodes(instance)
 	sortedNodeNames := make([]string, 0)
-	for name := range instance.Spec.Nodes {
+	for name := range nodes {
 		sortedNodeNames = append(sortedNodeNames, name)
 	}
 	sort.Strings(sortedNodeNames)
@@ -109,6 +143,8 @@ func createOrPatchDNSData(ctx context.Context, helper *helper.Helper,
 
 		dnsDetails.Hostnames[hostName] = map[infranetworkv1.NetNameStr]string{}
 		dnsDetails.AllIPs[hostName] = map[infranetworkv1.NetNameStr]string{}
+		dnsDetails.AllAddresses[hostName] = map[infranetworkv1.NetNameStr][]string{}
+		dnsDetails.DNSAliases[hostName] = map[infranetworkv1.NetNameStr][]string{}
 
 		shortName = strings.Split(hostName, ".")[0]
 		if len(nets) == 0 {
@@ -118,6 +154,9 @@ func createOrPatchDNSData(ctx context.Context, helper *helper.Helper,
 			// Get IPSet
 			ipSet, ok := allIPSets[hostName]
 			if ok {
+				primary := getPrimaryReservations(&ipSet)
+				// A record is added for every reservation, so that the
+				// hostnames of a dual-stack network resolve for both families
 				for _, res := range ipSet.Status.Reservation {
 					var fqdnNames []string
 					dnsRecord := infranetworkv1.DNSHost{}
@@ -132,7 +171,31 @@ func createOrPatchDNSData(ctx context.Context, helper *helper.Helper,
 						fqdnNames = append(fqdnNames, hostName)
 						dnsDetails.Hostnames[hostName][infranetworkv1.NetNameStr(netLower)] = hostName
 					}
-					dnsDetails.AllIPs[hostName][infranetworkv1.NetNameStr(netLower)] = res.Address
+					for _, alias := range node.DNSAliases {
+						aliasNetwork := strings.ToLower(string(alias.Network))
+						if aliasNetwork == "" {
+							aliasNetwork = dataplanev1.DNSAliasDefaultNetwork
+						}
+						if aliasNetwork != netLower {
+							continue
+						}
+						aliasName := alias.Name
+						if !strings.Contains(aliasName, ".") {
+							aliasName = strings.Join([]string{aliasName, res.DNSDomain}, ".")
+						}
+						fqdnNames = append(fqdnNames, aliasName)
+						if primary[netLower].Address == res.Address {
+							aliases := dnsDetails.DNSAliases[hostName][infranetworkv1.NetNameStr(netLower)]
+							aliases = append(aliases, aliasName)
+							sort.Strings(aliases)
+							dnsDetails.DNSAliases[hostName][infranetworkv1.NetNameStr(netLower)] = aliases
+						}
+					}
+					if primary[netLower].Address == res.Address {
+						dnsDetails.AllIPs[hostName][infranetworkv1.NetNameStr(netLower)] = res.Address
+					}
+					dnsDetails.AllAddresses[hostName][infranetworkv1.NetNameStr(netLower)] = append(
+						dnsDetails.AllAddresses[hostName][infranetworkv1.NetNameStr(netLower)], res.Address)
 					dnsRecord.Hostnames = fqdnNames
 					allDNSRecords = append(allDNSRecords, dnsRecord)
 					// Adding only ctlplane domain for ansibleee.
@@ -152,9 +215,13 @@ func createOrPatchDNSData(ctx context.Context, helper *helper.Helper,
 	}
 	_, err := controllerutil.CreateOrPatch(ctx, helper.GetClient(), dnsData, func() error {
 		dnsData.Spec.Hosts = allDNSRecords
-		// TODO (rabi) DNSDataLabelSelectorValue can probably be
-		// used from dnsmasq(?)
-		dnsData.Spec.DNSDataLabelSelectorValue = "dnsdata"
+		// Match the DNSDataLabelSelectorValue of the selected dnsmasq
+		dnsData.Spec.DNSDataLabelSelectorValue = dnsDetails.DNSDataLabelSelectorValue
+		if dnsData.Spec.DNSDataLabelSelectorValue == "" {
+			dnsData.Spec.DNSDataLabelSelectorValue = "dnsdata"
+		}
+		// The DNS records are kept until the teardown of the nodes is finished
+		controllerutil.AddFinalizer(dnsData, helper.GetFinalizer())
 		// Set controller reference to the DataPlaneNode object
 		err := controllerutil.SetControllerReference(
 			helper.GetBeforeObject(), dnsData, helper.GetScheme())
@@ -282,7 +349,7 @@ func reserveIPs(ctx context.Context, helper *helper.Helper,
 
 	allIPSets := make(map[string]infranetworkv1.IPSet)
 	// CreateOrPatch IPSets
-	for nodeName, node := range instance.Spec.Nodes {
+	for nodeName, node := range getActiveNodes(instance) {
 		nets := node.Networks
 		hostName := node.HostName
 		if len(nets) == 0 {
@@ -298,6 +365,12 @@ func reserveIPs(ctx context.Context, helper *helper.Helper,
 			}
 			_, err := controllerutil.CreateOrPatch(ctx, helper.GetClient(), ipSet, func() error {
 				ipSet.Spec.Networks = nets
+				if ipSet.Labels == nil {
+					ipSet.Labels = map[string]string{}
+				}
+				ipSet.Labels[NodeSetLabel] = instance.Name
+				// The IPs are kept until the teardown of the nodes is finished
+				controllerutil.AddFinalizer(ipSet, helper.GetFinalizer())
 				// Set controller reference to the DataPlaneNode object
 				err := controllerutil.SetControllerReference(
 					helper.GetBeforeObject(), ipSet, helper.GetScheme())
@@ -314,5 +387,33 @@ func reserveIPs(ctx context.Context, helper *helper.Helper,
 		}
 	}
 
+	// Release the IPs of the nodes removed from the NodeSet, or removed through
+	// the removal services
+	err = pruneIPSets(ctx, helper, instance)
+	if err != nil {
+		return nil, err
+	}
+
 	return allIPSets, nil
 }
+
+// isIPv6Address returns whether the address is an IPv6 address
+func isIPv6Address(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() == nil
+}
+
+// getPrimaryReservations returns the reservation of each network of an IPSet
+// providing the single address of the node on the network. On a dual-stack
+// network, the IPv4 reservation is preferred.
+func getPrimaryReservations(ipSet *infranetworkv1.IPSet) map[string]infranetworkv1.IPSetReservation {
+	primary := map[string]infranetworkv1.IPSetReservation{}
+	for _, res := range ipSet.Status.Reservation {
+		netLower := strings.ToLower(string(res.Network))
+		current, ok := primary[netLower]
+		if !ok || (isIPv6Address(current.Address) && !isIPv6Address(res.Address)) {
+			primary[netLower] = res
+		}
+	}
+	return primary
+}
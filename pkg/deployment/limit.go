@@ -0,0 +1,180 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+)
+
+// subscriptPattern matches the ansible host patterns selecting the hosts of a
+// group by their position, like webservers[0] or webservers[0:2]
+var subscriptPattern = regexp.MustCompile(`^(.+)\[(?:(-?[0-9]+)|([0-9]+)([:-])([0-9]+)?)\]$`)
+
+// GetTargetedHosts returns the host names of the nodes of the nodeset that are
+// targeted by an ansible limit. The limit is evaluated against the inventory
+// host names and the nodeset group, and supports the wildcard (*), regular
+// expression (~), intersection (&) and exclusion (!) patterns of ansible.
+// All the nodes are targeted when the limit is empty.
+// The returned bool is false when a part of the limit can't be resolved against
+// the nodeset, like an unknown group, a group subscript or a limit file, in
+// which case the hosts targeted by ansible may differ from the returned ones.
+func GetTargetedHosts(nodeSet *dataplanev1.OpenStackDataPlaneNodeSet, limit string) ([]string, bool, error) {
+	var included, intersections, exclusions []string
+	resolved := true
+	for _, pattern := range splitAnsibleLimit(limit) {
+		var target *[]string
+		switch {
+		case strings.HasPrefix(pattern, "!"):
+			target, pattern = &exclusions, pattern[1:]
+		case strings.HasPrefix(pattern, "&"):
+			target, pattern = &intersections, pattern[1:]
+		default:
+			target = &included
+		}
+		resolved = resolved && isKnownPattern(nodeSet, pattern)
+		*target = append(*target, pattern)
+	}
+	if len(included) == 0 {
+		included = []string{"all"}
+	}
+
+	hosts := []string{}
+	for _, node := range nodeSet.Spec.Nodes {
+		targeted, err := matchesAnyPattern(getNodeNames(nodeSet, node), included)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, pattern := range intersections {
+			if !targeted {
+				break
+			}
+			targeted, err = matchesAnyPattern(getNodeNames(nodeSet, node), []string{pattern})
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		if targeted {
+			excluded, err := matchesAnyPattern(getNodeNames(nodeSet, node), exclusions)
+			if err != nil {
+				return nil, false, err
+			}
+			targeted = !excluded
+		}
+		if targeted {
+			hosts = append(hosts, node.HostName)
+		}
+	}
+	sort.Strings(hosts)
+
+	return hosts, resolved, nil
+}
+
+// splitAnsibleLimit splits an ansible limit into its patterns the way ansible
+// does: on commas when the limit has any, and otherwise on the colons that
+// aren't part of a group subscript.
+func splitAnsibleLimit(limit string) []string {
+	var parts []string
+	if strings.Contains(limit, ",") {
+		parts = strings.Split(limit, ",")
+	} else {
+		depth := 0
+		parts = strings.FieldsFunc(limit, func(r rune) bool {
+			switch r {
+			case '[':
+				depth++
+			case ']':
+				depth--
+			}
+			return r == ':' && depth <= 0
+		})
+	}
+
+	patterns := []string{}
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			patterns = append(patterns, part)
+		}
+	}
+
+	return patterns
+}
+
+// getNodeNames returns the names a node of the nodeset can be targeted with
+func getNodeNames(nodeSet *dataplanev1.OpenStackDataPlaneNodeSet, node dataplanev1.NodeSection) []string {
+	return []string{
+		"all",
+		nodeSet.Name,
+		strings.Split(node.HostName, ".")[0],
+		node.HostName,
+	}
+}
+
+// isKnownPattern returns whether an ansible host pattern can be evaluated
+// against the nodeset. Limit files (@) and group subscripts ([]) depend on
+// what's outside the nodeset, and a name without wildcard is known only when
+// it's a name of the nodeset or of one of its nodes.
+func isKnownPattern(nodeSet *dataplanev1.OpenStackDataPlaneNodeSet, pattern string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "~"):
+		return true
+	case strings.HasPrefix(pattern, "@"), subscriptPattern.MatchString(pattern):
+		return false
+	case strings.ContainsAny(pattern, "*?["):
+		return true
+	}
+	for _, node := range nodeSet.Spec.Nodes {
+		if slices.Contains(getNodeNames(nodeSet, node), pattern) {
+			return true
+		}
+	}
+
+	return pattern == "all" || pattern == nodeSet.Name
+}
+
+// matchesAnyPattern returns whether any of the names matches any of the
+// ansible host patterns
+func matchesAnyPattern(names []string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			var matched bool
+			var err error
+			if strings.HasPrefix(pattern, "~") {
+				// ansible matches the regular expression at the start
+				// of the name only, as python re.match does
+				matched, err = regexp.MatchString("^(?:"+pattern[1:]+")", name)
+			} else {
+				matched, err = path.Match(pattern, name)
+			}
+			if err != nil {
+				return false, fmt.Errorf("invalid ansible limit pattern %s - %w", pattern, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+	corev1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	certmgrv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
+	condition "github.com/openstack-k8s-operators/lib-common/modules/common/condition"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
+)
+
+// GetNodeRemovalDeploymentName returns the name of the deployment running the
+// removal services on a node of a NodeSet
+func GetNodeRemovalDeploymentName(instance *dataplanev1.OpenStackDataPlaneNodeSet, nodeName string) string {
+	nodeName = strings.NewReplacer(".", "-", "_", "-").Replace(strings.ToLower(nodeName))
+	return fmt.Sprintf("%s-remove-%s", instance.Name, nodeName)
+}
+
+// RemoveNodes runs the removal services of the NodeSet on each node in the
+// Removing state, through an OpenStackDataPlaneDeployment limited to the node.
+// Once the removal services are finished, the certs of the node are deleted and
+// the node is recorded in the RemovedNodes status, releasing its IPs and
+// baremetal host.
+func RemoveNodes(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) (ctrl.Result, error) {
+	err := pruneNodeRemovalDeployments(ctx, helper, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Forget the removed nodes which were deleted from the NodeSet, or whose
+	// removal was cancelled
+	removedNodes := []string{}
+	for _, nodeName := range instance.Status.RemovedNodes {
+		if node, ok := instance.Spec.Nodes[nodeName]; ok && node.State == dataplanev1.NodeStateRemoving {
+			removedNodes = append(removedNodes, nodeName)
+		}
+	}
+	instance.Status.RemovedNodes = removedNodes
+
+	nodeNames := []string{}
+	for nodeName, node := range instance.Spec.Nodes {
+		if node.State == dataplanev1.NodeStateRemoving && !isNodeRemoved(instance, nodeName) {
+			nodeNames = append(nodeNames, nodeName)
+		}
+	}
+	if len(nodeNames) == 0 {
+		return ctrl.Result{}, nil
+	}
+	sort.Strings(nodeNames)
+
+	removedNodes = []string{}
+	runningDeployments := []string{}
+	for _, nodeName := range nodeNames {
+		isRemoved, err := runNodeRemoval(ctx, helper, instance, nodeName)
+		if err != nil {
+			instance.Status.Conditions.MarkFalse(
+				dataplanev1.NodeSetNodeRemovalReadyCondition,
+				condition.ErrorReason,
+				condition.SeverityError,
+				dataplanev1.NodeSetNodeRemovalReadyErrorMessage,
+				err.Error())
+			return ctrl.Result{}, err
+		}
+		if isRemoved {
+			removedNodes = append(removedNodes, nodeName)
+		} else {
+			runningDeployments = append(runningDeployments, GetNodeRemovalDeploymentName(instance, nodeName))
+		}
+	}
+
+	if len(runningDeployments) != 0 {
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetNodeRemovalReadyCondition,
+			condition.RequestedReason,
+			condition.SeverityInfo,
+			dataplanev1.NodeSetNodeRemovalReadyRunningMessage,
+			strings.Join(runningDeployments, ", "))
+	} else {
+		instance.Status.Conditions.MarkTrue(
+			dataplanev1.NodeSetNodeRemovalReadyCondition,
+			dataplanev1.NodeSetNodeRemovalReadyMessage)
+	}
+	if len(removedNodes) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	for _, nodeName := range removedNodes {
+		err = deleteNodeCerts(ctx, helper, instance, instance.Spec.Nodes[nodeName].HostName)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The IPSets and the baremetal hosts of the removed nodes are released
+	// when the NodeSet is reconciled again with the recorded status
+	instance.Status.RemovedNodes = append(instance.Status.RemovedNodes, removedNodes...)
+	sort.Strings(instance.Status.RemovedNodes)
+	helper.GetLogger().Info("Removed nodes from NodeSet", "nodes", removedNodes)
+
+	return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+}
+
+// isNodeRemoved returns whether the removal services of a node in the Removing
+// state are finished
+func isNodeRemoved(instance *dataplanev1.OpenStackDataPlaneNodeSet, nodeName string) bool {
+	node, ok := instance.Spec.Nodes[nodeName]
+	return ok && node.State == dataplanev1.NodeStateRemoving &&
+		slices.Contains(instance.Status.RemovedNodes, nodeName)
+}
+
+// getActiveNodes returns the nodes of a NodeSet which are not removed, and
+// keep their IPs, DNS records and baremetal hosts
+func getActiveNodes(instance *dataplanev1.OpenStackDataPlaneNodeSet) map[string]dataplanev1.NodeSection {
+	nodes := map[string]dataplanev1.NodeSection{}
+	for nodeName, node := range instance.Spec.Nodes {
+		if !isNodeRemoved(instance, nodeName) {
+			nodes[nodeName] = node
+		}
+	}
+	return nodes
+}
+
+// GetInventoryNodes returns the nodes of a NodeSet in the inventory of a
+// deployment. The nodes in the Removing state are left out of the inventory of
+// the regular deployments, and are only in the inventory of the removal
+// deployments until their removal services are finished.
+func GetInventoryNodes(instance *dataplanev1.OpenStackDataPlaneNodeSet, isNodeRemoval bool) map[string]dataplanev1.NodeSection {
+	nodes := map[string]dataplanev1.NodeSection{}
+	for nodeName, node := range getActiveNodes(instance) {
+		if (node.State == dataplanev1.NodeStateRemoving) == isNodeRemoval {
+			nodes[nodeName] = node
+		}
+	}
+	return nodes
+}
+
+// GetCertNodes returns the nodes of a NodeSet the TLS certs are issued for. The
+// nodes in the Removing state keep their certs until they are removed, so that
+// the regular and the removal deployments share the same cert secrets.
+func GetCertNodes(instance *dataplanev1.OpenStackDataPlaneNodeSet) map[string]dataplanev1.NodeSection {
+	return getActiveNodes(instance)
+}
+
+// runNodeRemoval runs the removal services on a node and returns whether they
+// are finished
+func runNodeRemoval(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, nodeName string,
+) (bool, error) {
+	if len(instance.Spec.Removal) == 0 {
+		return true, nil
+	}
+
+	removal := &dataplanev1.OpenStackDataPlaneDeployment{}
+	err := helper.GetClient().Get(ctx, types.NamespacedName{
+		Name:      GetNodeRemovalDeploymentName(instance, nodeName),
+		Namespace: instance.Namespace,
+	}, removal)
+	if k8s_errors.IsNotFound(err) {
+		removal = &dataplanev1.OpenStackDataPlaneDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetNodeRemovalDeploymentName(instance, nodeName),
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					NodeSetLabel:     instance.Name,
+					NodeRemovalLabel: nodeName,
+				},
+			},
+			Spec: dataplanev1.OpenStackDataPlaneDeploymentSpec{
+				NodeSets:              []string{instance.Name},
+				ServicesOverride:      instance.Spec.Removal,
+				AnsibleLimit:          instance.Spec.Nodes[nodeName].HostName,
+				DeploymentRequeueTime: 15,
+			},
+		}
+		err = controllerutil.SetControllerReference(instance, removal, helper.GetScheme())
+		if err != nil {
+			return false, err
+		}
+		helper.GetLogger().Info("Creating node removal deployment", "deployment", removal.Name)
+		return false, helper.GetClient().Create(ctx, removal)
+	} else if err != nil {
+		return false, err
+	}
+
+	deployCondition := removal.Status.Conditions.Get(condition.DeploymentReadyCondition)
+	if condition.IsError(deployCondition) {
+		// The removal deployment can be deleted to retry the removal
+		return false, fmt.Errorf("deployment %s failed: %s", removal.Name, deployCondition.Message)
+	}
+
+	return removal.Status.Deployed, nil
+}
+
+// pruneNodeRemovalDeployments deletes the removal deployments of the nodes which
+// are no longer in the Removing state, or were removed from the NodeSet
+func pruneNodeRemovalDeployments(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) error {
+	removals := &dataplanev1.OpenStackDataPlaneDeploymentList{}
+	err := helper.GetClient().List(ctx, removals,
+		client.InNamespace(instance.Namespace),
+		client.MatchingLabels{NodeSetLabel: instance.Name},
+		client.HasLabels{NodeRemovalLabel})
+	if err != nil {
+		return err
+	}
+	for i := range removals.Items {
+		removal := &removals.Items[i]
+		node, ok := instance.Spec.Nodes[removal.Labels[NodeRemovalLabel]]
+		if ok && node.State == dataplanev1.NodeStateRemoving {
+			continue
+		}
+		if !metav1.IsControlledBy(removal, instance) || !removal.DeletionTimestamp.IsZero() {
+			continue
+		}
+		helper.GetLogger().Info("Deleting node removal deployment", "deployment", removal.Name)
+		err = helper.GetClient().Delete(ctx, removal)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteNodeCerts deletes the certificates issued for a node of the NodeSet,
+// along with their secrets
+func deleteNodeCerts(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, hostName string,
+) error {
+	labels := client.MatchingLabels{
+		NodeSetLabel:  instance.Name,
+		HostnameLabel: hostName,
+	}
+
+	certs := &certmgrv1.CertificateList{}
+	err := helper.GetClient().List(ctx, certs, client.InNamespace(instance.Namespace), labels)
+	if err != nil {
+		return err
+	}
+	for i := range certs.Items {
+		err = helper.GetClient().Delete(ctx, &certs.Items[i])
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	secrets := &corev1.SecretList{}
+	err = helper.GetClient().List(ctx, secrets, client.InNamespace(instance.Namespace), labels)
+	if err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		err = helper.GetClient().Delete(ctx, &secrets.Items[i])
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneIPSets deletes the IPSets of the NodeSet whose node is no longer in
+// the NodeSet, or is removed
+func pruneIPSets(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) error {
+	hostNames := map[string]bool{}
+	for _, node := range getActiveNodes(instance) {
+		hostNames[node.HostName] = true
+	}
+
+	ipSets := &infranetworkv1.IPSetList{}
+	err := helper.GetClient().List(ctx, ipSets,
+		client.InNamespace(instance.Namespace),
+		client.MatchingLabels{NodeSetLabel: instance.Name})
+	if err != nil {
+		return err
+	}
+	for i := range ipSets.Items {
+		ipSet := &ipSets.Items[i]
+		if hostNames[ipSet.Name] || !metav1.IsControlledBy(ipSet, instance) {
+			continue
+		}
+		helper.GetLogger().Info("Releasing IPSet of removed node", "ipset", ipSet.Name)
+		if controllerutil.RemoveFinalizer(ipSet, helper.GetFinalizer()) {
+			err = helper.GetClient().Update(ctx, ipSet)
+			if err != nil && !k8s_errors.IsNotFound(err) {
+				return err
+			}
+		}
+		err = helper.GetClient().Delete(ctx, ipSet)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	metal3v1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	condition "github.com/openstack-k8s-operators/lib-common/modules/common/condition"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
+	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
+)
+
+// unassignedBMH is the BmhRef of a host of a BaremetalSet without a baremetal host
+const unassignedBMH = "unassigned"
+
+// nodeSetKind is the Kind set in the consumerRef of the held baremetal hosts
+const nodeSetKind = "OpenStackDataPlaneNodeSet"
+
+// GetNodeReplacementDeploymentName returns the name of the deployment running the
+// replace services on a node of a NodeSet, for a replaceGeneration of the node
+func GetNodeReplacementDeploymentName(instance *dataplanev1.OpenStackDataPlaneNodeSet,
+	nodeName string, generation int64,
+) string {
+	nodeName = strings.NewReplacer(".", "-", "_", "-").Replace(strings.ToLower(nodeName))
+	return fmt.Sprintf("%s-replace-%s-%d", instance.Name, nodeName, generation)
+}
+
+// startNodeReplacements records the replacements requested by a change of the
+// replaceGeneration of the nodes, along with the baremetal host each node was
+// provisioned on. It returns the host names of the nodes whose replaced
+// baremetal host is not released from the BaremetalSet, and held, yet.
+func startNodeReplacements(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+	hosts map[string]baremetalv1.HostStatus,
+) (map[string]bool, error) {
+	releasingHosts := map[string]bool{}
+	for nodeName, node := range instance.Spec.Nodes {
+		replacement, ok := instance.Status.NodeReplacements[nodeName]
+		if !ok && node.ReplaceGeneration == 0 {
+			continue
+		}
+		if !ok || replacement.Generation != node.ReplaceGeneration {
+			replacement = dataplanev1.NodeReplacementStatus{
+				Generation: node.ReplaceGeneration,
+			}
+			hostStatus, isProvisioned := hosts[node.HostName]
+			switch {
+			case !ok && instance.Status.DeployedConfigHash == "":
+				// There is nothing to replace on a node that was never deployed
+				replacement.Released = true
+				replacement.Completed = true
+			case isProvisioned && hostStatus.BmhRef != "" && hostStatus.BmhRef != unassignedBMH:
+				replacement.ReplacedBMH = hostStatus.BmhRef
+			default:
+				replacement.Released = true
+			}
+		}
+		if !replacement.Released {
+			hostStatus, isProvisioned := hosts[node.HostName]
+			isHeld := false
+			if !isProvisioned || hostStatus.BmhRef != replacement.ReplacedBMH {
+				var err error
+				isHeld, err = holdReplacedBMH(ctx, helper, instance, replacement.ReplacedBMH)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if isHeld {
+				replacement.Released = true
+			} else {
+				releasingHosts[node.HostName] = true
+			}
+		}
+		if instance.Status.NodeReplacements == nil {
+			instance.Status.NodeReplacements = map[string]dataplanev1.NodeReplacementStatus{}
+		}
+		instance.Status.NodeReplacements[nodeName] = replacement
+	}
+
+	return releasingHosts, nil
+}
+
+// holdReplacedBMH sets a consumerRef to the NodeSet on the replaced baremetal
+// host of a node, once it is released by the BaremetalSet, so that it is not
+// selected again for the node or for another node. It returns whether the
+// baremetal host is held.
+func holdReplacedBMH(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, bmhName string,
+) (bool, error) {
+	bmhNamespace := instance.Spec.BaremetalSetTemplate.BmhNamespace
+	if bmhNamespace == "" {
+		bmhNamespace = defaultBmhNamespace
+	}
+	bmh := &metal3v1.BareMetalHost{}
+	err := helper.GetClient().Get(ctx, types.NamespacedName{Name: bmhName, Namespace: bmhNamespace}, bmh)
+	if k8s_errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		// There is nothing left to hold
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	consumerRef := bmh.Spec.ConsumerRef
+	if consumerRef != nil {
+		// The baremetal host is still consumed by the BaremetalSet
+		return consumerRef.Kind == nodeSetKind && consumerRef.Name == instance.Name &&
+			consumerRef.Namespace == instance.Namespace, nil
+	}
+	bmh.Spec.ConsumerRef = &corev1.ObjectReference{
+		APIVersion: dataplanev1.GroupVersion.String(),
+		Kind:       nodeSetKind,
+		Name:       instance.Name,
+		Namespace:  instance.Namespace,
+	}
+	helper.GetLogger().Info("Holding the replaced baremetal host", "bmh", bmhName)
+	err = helper.GetClient().Update(ctx, bmh)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReplaceNodes runs the replace services of the NodeSet on each node whose
+// replaceGeneration changed, through an OpenStackDataPlaneDeployment limited to
+// the node, once the node is provisioned again. The IPSet, DNS records and certs
+// of the node are kept.
+func ReplaceNodes(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) (ctrl.Result, error) {
+	// The replacements of the nodes of a NodeSet with baremetal nodes are started
+	// when reconciling the BaremetalSet, as their baremetal hosts need to be
+	// released first
+	if !instance.Spec.HasBaremetalNodes() {
+		_, err := startNodeReplacements(ctx, helper, instance, nil)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	for nodeName := range instance.Status.NodeReplacements {
+		if _, ok := instance.Spec.Nodes[nodeName]; !ok {
+			delete(instance.Status.NodeReplacements, nodeName)
+		}
+	}
+
+	err := pruneNodeReplacementDeployments(ctx, helper, instance)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	nodeNames := []string{}
+	for nodeName, replacement := range instance.Status.NodeReplacements {
+		if !replacement.Completed {
+			nodeNames = append(nodeNames, nodeName)
+		}
+	}
+	if len(nodeNames) == 0 {
+		return ctrl.Result{}, nil
+	}
+	sort.Strings(nodeNames)
+
+	runningDeployments := []string{}
+	for _, nodeName := range nodeNames {
+		replacement := instance.Status.NodeReplacements[nodeName]
+		isReplaced, err := runNodeReplacement(ctx, helper, instance, nodeName, replacement.Generation)
+		if err != nil {
+			instance.Status.Conditions.MarkFalse(
+				dataplanev1.NodeSetNodeReplacementReadyCondition,
+				condition.ErrorReason,
+				condition.SeverityError,
+				dataplanev1.NodeSetNodeReplacementReadyErrorMessage,
+				err.Error())
+			return ctrl.Result{}, err
+		}
+		if isReplaced {
+			replacement.Completed = true
+			instance.Status.NodeReplacements[nodeName] = replacement
+			helper.GetLogger().Info("Replaced node of NodeSet", "node", nodeName)
+		} else {
+			runningDeployments = append(runningDeployments,
+				GetNodeReplacementDeploymentName(instance, nodeName, replacement.Generation))
+		}
+	}
+
+	if len(runningDeployments) != 0 {
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetNodeReplacementReadyCondition,
+			condition.RequestedReason,
+			condition.SeverityInfo,
+			dataplanev1.NodeSetNodeReplacementReadyRunningMessage,
+			strings.Join(runningDeployments, ", "))
+	} else {
+		instance.Status.Conditions.MarkTrue(
+			dataplanev1.NodeSetNodeReplacementReadyCondition,
+			dataplanev1.NodeSetNodeReplacementReadyMessage)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// runNodeReplacement runs the replace services on a node and returns whether
+// they are finished
+func runNodeReplacement(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, nodeName string, generation int64,
+) (bool, error) {
+	replace := &dataplanev1.OpenStackDataPlaneDeployment{}
+	err := helper.GetClient().Get(ctx, types.NamespacedName{
+		Name:      GetNodeReplacementDeploymentName(instance, nodeName, generation),
+		Namespace: instance.Namespace,
+	}, replace)
+	if k8s_errors.IsNotFound(err) {
+		replace = &dataplanev1.OpenStackDataPlaneDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetNodeReplacementDeploymentName(instance, nodeName, generation),
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					NodeSetLabel:         instance.Name,
+					NodeReplacementLabel: nodeName,
+				},
+			},
+			Spec: dataplanev1.OpenStackDataPlaneDeploymentSpec{
+				NodeSets:              []string{instance.Name},
+				ServicesOverride:      instance.Spec.Replace,
+				AnsibleLimit:          instance.Spec.Nodes[nodeName].HostName,
+				DeploymentRequeueTime: 15,
+			},
+		}
+		err = controllerutil.SetControllerReference(instance, replace, helper.GetScheme())
+		if err != nil {
+			return false, err
+		}
+		helper.GetLogger().Info("Creating node replacement deployment", "deployment", replace.Name)
+		return false, helper.GetClient().Create(ctx, replace)
+	} else if err != nil {
+		return false, err
+	}
+
+	deployCondition := replace.Status.Conditions.Get(condition.DeploymentReadyCondition)
+	if condition.IsError(deployCondition) {
+		// The replacement deployment can be deleted to retry the replacement
+		return false, fmt.Errorf("deployment %s failed: %s", replace.Name, deployCondition.Message)
+	}
+
+	return replace.Status.Deployed, nil
+}
+
+// pruneNodeReplacementDeployments deletes the replacement deployments of the
+// previous replaceGenerations of the nodes, or of nodes removed from the NodeSet
+func pruneNodeReplacementDeployments(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) error {
+	replacements := &dataplanev1.OpenStackDataPlaneDeploymentList{}
+	err := helper.GetClient().List(ctx, replacements,
+		client.InNamespace(instance.Namespace),
+		client.MatchingLabels{NodeSetLabel: instance.Name},
+		client.HasLabels{NodeReplacementLabel})
+	if err != nil {
+		return err
+	}
+	for i := range replacements.Items {
+		replace := &replacements.Items[i]
+		nodeName := replace.Labels[NodeReplacementLabel]
+		replacement, ok := instance.Status.NodeReplacements[nodeName]
+		if ok && replace.Name == GetNodeReplacementDeploymentName(instance, nodeName, replacement.Generation) {
+			continue
+		}
+		if !metav1.IsControlledBy(replace, instance) || !replace.DeletionTimestamp.IsZero() {
+			continue
+		}
+		helper.GetLogger().Info("Deleting node replacement deployment", "deployment", replace.Name)
+		err = helper.GetClient().Delete(ctx, replace)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
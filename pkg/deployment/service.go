@@ -17,15 +17,20 @@ limitations under the License.
 package deployment
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	yaml "gopkg.in/yaml.v3"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/go-playground/validator/v10"
@@ -72,88 +77,145 @@ func GetService(ctx context.Context, helper *helper.Helper, service string) (dat
 	return *foundService, err
 }
 
-// EnsureServices - ensure the OpenStackDataPlaneServices exist
-func EnsureServices(ctx context.Context, helper *helper.Helper, instance *dataplanev1.OpenStackDataPlaneNodeSet, validation *validator.Validate) error {
+// ServiceCatalog - the default services ensured by the operator
+type ServiceCatalog struct {
+	// Version - the hash of the default services
+	Version string
+	// Services - the default services, sorted by name
+	Services []dataplanev1.OpenStackDataPlaneService
+}
+
+// GetServicesPath returns the directory holding the default services, from
+// the OPERATOR_SERVICES env var
+func GetServicesPath() string {
 	servicesPath, found := os.LookupEnv("OPERATOR_SERVICES")
 	if !found {
 		servicesPath = "config/services"
-		os.Setenv("OPERATOR_SERVICES", servicesPath)
-		util.LogForObject(
-			helper, "OPERATOR_SERVICES not set in env when reconciling ", instance,
-			"defaulting to ", servicesPath)
 	}
+	return servicesPath
+}
 
-	helper.GetLogger().Info("Ensuring services", "servicesPath", servicesPath)
-	services, err := os.ReadDir(servicesPath)
+// LoadServiceCatalog - loads and validates the default services from the YAML
+// files of a directory
+func LoadServiceCatalog(servicesPath string) (*ServiceCatalog, error) {
+	files, err := os.ReadDir(servicesPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, service := range services {
-
-		servicePath := path.Join(servicesPath, service.Name())
-
-		if !strings.HasSuffix(service.Name(), ".yaml") {
-			helper.GetLogger().Info("Skipping ensuring service from file without .yaml suffix", "file", service.Name())
+	validation := validator.New()
+	catalog := &ServiceCatalog{}
+	serviceNames := map[string]string{}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".yaml") {
 			continue
 		}
+		servicePath := path.Join(servicesPath, file.Name())
 
-		data, _ := os.ReadFile(servicePath)
+		data, err := os.ReadFile(servicePath)
+		if err != nil {
+			return nil, err
+		}
 		var serviceObj ServiceYAML
 		err = yaml.Unmarshal(data, &serviceObj)
 		if err != nil {
-			helper.GetLogger().Info("Service YAML file Unmarshal error", "service YAML file", servicePath)
-			return err
+			return nil, fmt.Errorf("error unmarshalling service YAML file %s: %w", servicePath, err)
 		}
 
 		if serviceObj.Kind != "OpenStackDataPlaneService" {
-			helper.GetLogger().Info("Skipping ensuring service since kind is not OpenStackDataPlaneService", "file", servicePath, "Kind", serviceObj.Kind)
 			continue
 		}
 
 		serviceObjMeta := &metav1.ObjectMeta{}
 		err = serviceObj.Metadata.Decode(serviceObjMeta)
 		if err != nil {
-			helper.GetLogger().Info("Service Metadata decode error")
-			return err
+			return nil, fmt.Errorf("error decoding service metadata of %s: %w", servicePath, err)
 		}
 		// Check if service name matches RFC1123 for use in labels
 		if err = validation.Var(serviceObjMeta.Name, "hostname_rfc1123"); err != nil {
-			helper.GetLogger().Info("service name must follow RFC1123")
-			return err
+			return nil, fmt.Errorf("service name %q of %s must follow RFC1123: %w", serviceObjMeta.Name, servicePath, err)
 		}
-		roleContainsService := false
-		for _, roleServiceName := range instance.Spec.Services {
-			if roleServiceName == serviceObjMeta.Name {
-				roleContainsService = true
-				break
-			}
-		}
-		if !roleContainsService {
-			helper.GetLogger().Info("Skipping ensure service since it is not a service on this role", "service", serviceObjMeta.Name)
-			continue
+		if otherPath, ok := serviceNames[serviceObjMeta.Name]; ok {
+			return nil, fmt.Errorf("service %s is defined in both %s and %s", serviceObjMeta.Name, otherPath, servicePath)
 		}
+		serviceNames[serviceObjMeta.Name] = servicePath
 
 		serviceObjSpec := &dataplanev1.OpenStackDataPlaneServiceSpec{}
 		err = serviceObj.Spec.Decode(serviceObjSpec)
 		if err != nil {
-			helper.GetLogger().Info("Service Spec decode error")
-			return err
+			return nil, fmt.Errorf("error decoding service spec of %s: %w", servicePath, err)
 		}
 
+		catalog.Services = append(catalog.Services, dataplanev1.OpenStackDataPlaneService{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: serviceObjMeta.Name,
+			},
+			Spec: *serviceObjSpec,
+		})
+	}
+	sort.Slice(catalog.Services, func(i, j int) bool {
+		return catalog.Services[i].Name < catalog.Services[j].Name
+	})
+
+	catalog.Version, err = util.ObjectHash(catalog.Services)
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+// EnsureServices - ensure the OpenStackDataPlaneServices of the catalog used by the NodeSet exist
+func EnsureServices(ctx context.Context, helper *helper.Helper, instance *dataplanev1.OpenStackDataPlaneNodeSet, catalog *ServiceCatalog) error {
+	helper.GetLogger().Info("Ensuring services", "catalogVersion", catalog.Version)
+	for i := range catalog.Services {
+		serviceName := catalog.Services[i].Name
+		if !serviceInList(serviceName, instance.Spec.Services) {
+			helper.GetLogger().Info("Skipping ensure service since it is not a service on this role", "service", serviceName)
+			continue
+		}
+		serviceObjSpec := catalog.Services[i].Spec.DeepCopy()
+		// Apply the defaults of the webhook, so that they are not taken for
+		// changes made by the user
+		serviceObjSpec.Default(serviceName)
+
 		ensureService := &dataplanev1.OpenStackDataPlaneService{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      serviceObjMeta.Name,
+				Name:      serviceName,
 				Namespace: instance.Namespace,
 			},
 		}
+		err := helper.GetClient().Get(ctx, client.ObjectKeyFromObject(ensureService), ensureService)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return err
+		}
+		if ensureService.Annotations[dataplanev1.ServiceManagedAnnotation] == "false" {
+			helper.GetLogger().Info("Skipping ensure service since it is not managed by the operator", "service", serviceName)
+			continue
+		}
+		defaultRevision, err := util.ObjectHash(serviceObjSpec)
+		if err != nil {
+			return err
+		}
 		_, err = controllerutil.CreateOrPatch(ctx, helper.GetClient(), ensureService, func() error {
-			serviceObjSpec.DeepCopyInto(&ensureService.Spec)
+			err := mergeDefaultServiceSpec(ensureService, serviceObjSpec)
+			if err != nil {
+				return err
+			}
+			ensureService.Annotations[dataplanev1.ServiceCatalogVersionAnnotation] = catalog.Version
 			return nil
 		})
 		if err != nil {
 			return fmt.Errorf("error ensuring service: %w", err)
 		}
+		if ensureService.Status.DefaultRevision != defaultRevision {
+			patch := client.MergeFrom(ensureService.DeepCopy())
+			ensureService.Status.DefaultRevision = defaultRevision
+			err = helper.GetClient().Status().Patch(ctx, ensureService, patch)
+			if err != nil {
+				return fmt.Errorf("error recording the default revision of service: %w", err)
+			}
+		}
 
 	}
 
@@ -195,3 +257,67 @@ func serviceInList(service string, services []string) bool {
 	}
 	return false
 }
+
+// mergeDefaultServiceSpec applies the default spec of a service on top of its
+// current spec. The fields of the spec changed since the default spec was last
+// applied are kept, the others are set from the default spec.
+func mergeDefaultServiceSpec(service *dataplanev1.OpenStackDataPlaneService,
+	defaultSpec *dataplanev1.OpenStackDataPlaneServiceSpec,
+) error {
+	modified, err := json.Marshal(defaultSpec)
+	if err != nil {
+		return err
+	}
+	lastApplied, ok := service.Annotations[dataplanev1.ServiceLastAppliedDefaultAnnotation]
+	if !ok {
+		// The services created before the default spec was recorded were kept
+		// in line with the default spec
+		defaultSpec.DeepCopyInto(&service.Spec)
+	} else {
+		lastAppliedFields := map[string]json.RawMessage{}
+		err = json.Unmarshal([]byte(lastApplied), &lastAppliedFields)
+		if err != nil {
+			return err
+		}
+		current, err := json.Marshal(service.Spec)
+		if err != nil {
+			return err
+		}
+		currentFields := map[string]json.RawMessage{}
+		err = json.Unmarshal(current, &currentFields)
+		if err != nil {
+			return err
+		}
+		mergedFields := map[string]json.RawMessage{}
+		err = json.Unmarshal(modified, &mergedFields)
+		if err != nil {
+			return err
+		}
+		for field := range lastAppliedFields {
+			if !bytes.Equal(lastAppliedFields[field], currentFields[field]) {
+				delete(mergedFields, field)
+			}
+		}
+		for field := range currentFields {
+			if !bytes.Equal(lastAppliedFields[field], currentFields[field]) {
+				mergedFields[field] = currentFields[field]
+			}
+		}
+		merged, err := json.Marshal(mergedFields)
+		if err != nil {
+			return err
+		}
+		spec := dataplanev1.OpenStackDataPlaneServiceSpec{}
+		err = json.Unmarshal(merged, &spec)
+		if err != nil {
+			return err
+		}
+		service.Spec = spec
+	}
+
+	if service.Annotations == nil {
+		service.Annotations = map[string]string{}
+	}
+	service.Annotations[dataplanev1.ServiceLastAppliedDefaultAnnotation] = string(modified)
+	return nil
+}
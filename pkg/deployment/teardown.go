@@ -0,0 +1,215 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
+	condition "github.com/openstack-k8s-operators/lib-common/modules/common/condition"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
+	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
+)
+
+// GetTeardownDeploymentName returns the name of the deployment running the
+// teardown services of a NodeSet
+func GetTeardownDeploymentName(instance *dataplanev1.OpenStackDataPlaneNodeSet) string {
+	return fmt.Sprintf("%s-teardown", instance.Name)
+}
+
+// TeardownNodeSet runs the teardown services of a deleted NodeSet, through an
+// OpenStackDataPlaneDeployment, and returns whether they are finished.
+func TeardownNodeSet(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) (bool, error) {
+	// There is nothing to tear down on nodes that were never deployed
+	if len(instance.Spec.Teardown) == 0 || instance.Status.DeployedConfigHash == "" {
+		instance.Status.Conditions.MarkTrue(
+			dataplanev1.NodeSetTeardownReadyCondition,
+			dataplanev1.NodeSetTeardownReadyMessage)
+		return true, nil
+	}
+
+	teardown := &dataplanev1.OpenStackDataPlaneDeployment{}
+	err := helper.GetClient().Get(ctx, types.NamespacedName{
+		Name:      GetTeardownDeploymentName(instance),
+		Namespace: instance.Namespace,
+	}, teardown)
+	if k8s_errors.IsNotFound(err) {
+		teardown = &dataplanev1.OpenStackDataPlaneDeployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetTeardownDeploymentName(instance),
+				Namespace: instance.Namespace,
+			},
+			Spec: dataplanev1.OpenStackDataPlaneDeploymentSpec{
+				NodeSets:              []string{instance.Name},
+				ServicesOverride:      instance.Spec.Teardown,
+				DeploymentRequeueTime: 15,
+			},
+		}
+		// The teardown deployment is not owned by the NodeSet, so that a
+		// foreground deletion of the NodeSet doesn't delete it before it is
+		// finished. It is deleted once the resources of the NodeSet are released.
+		helper.GetLogger().Info("Creating teardown deployment", "deployment", teardown.Name)
+		err = helper.GetClient().Create(ctx, teardown)
+	}
+	if err != nil {
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetTeardownReadyCondition,
+			condition.ErrorReason,
+			condition.SeverityError,
+			dataplanev1.NodeSetTeardownReadyErrorMessage,
+			err.Error())
+		return false, err
+	}
+
+	deployCondition := teardown.Status.Conditions.Get(condition.DeploymentReadyCondition)
+	switch {
+	case teardown.Status.Deployed:
+		instance.Status.Conditions.MarkTrue(
+			dataplanev1.NodeSetTeardownReadyCondition,
+			dataplanev1.NodeSetTeardownReadyMessage)
+		return true, nil
+	case condition.IsError(deployCondition):
+		// The teardown deployment can be deleted to retry the teardown
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetTeardownReadyCondition,
+			condition.ErrorReason,
+			condition.SeverityError,
+			dataplanev1.NodeSetTeardownReadyErrorMessage,
+			deployCondition.Message)
+	default:
+		instance.Status.Conditions.MarkFalse(
+			dataplanev1.NodeSetTeardownReadyCondition,
+			condition.RequestedReason,
+			condition.SeverityInfo,
+			dataplanev1.NodeSetTeardownReadyRunningMessage,
+			teardown.Name)
+	}
+
+	return false, nil
+}
+
+// AddTeardownFinalizer adds the finalizer of the NodeSet to one of the
+// resources it owns which the teardown of its nodes relies on, so that a
+// foreground deletion of the NodeSet doesn't delete the resource before the
+// teardown is finished and the resource is released.
+func AddTeardownFinalizer(ctx context.Context, helper *helper.Helper, obj client.Object) error {
+	if !controllerutil.AddFinalizer(obj, helper.GetFinalizer()) {
+		return nil
+	}
+
+	return helper.GetClient().Update(ctx, obj)
+}
+
+// ReleaseNodeSetResources deletes the BaremetalSet, and once it is gone, the
+// DNSData, IPSets and inventory of a NodeSet whose teardown is finished, along
+// with its teardown deployment. It returns whether all the resources are
+// released.
+func ReleaseNodeSetResources(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) (bool, error) {
+	// Deprovision the baremetal hosts before releasing their IPs
+	if instance.Spec.HasBaremetalNodes() {
+		isDeleted, err := deleteOwnedObject(ctx, helper, instance,
+			&baremetalv1.OpenStackBaremetalSet{}, instance.Name)
+		if err != nil || !isDeleted {
+			return false, err
+		}
+	}
+
+	isReleased, err := deleteOwnedObject(ctx, helper, instance,
+		&infranetworkv1.DNSData{}, instance.Name)
+	if err != nil {
+		return false, err
+	}
+	for _, node := range instance.Spec.Nodes {
+		isDeleted, err := deleteOwnedObject(ctx, helper, instance,
+			&infranetworkv1.IPSet{}, node.HostName)
+		if err != nil {
+			return false, err
+		}
+		isReleased = isReleased && isDeleted
+	}
+	if !isReleased {
+		return false, nil
+	}
+
+	isReleased, err = deleteOwnedObject(ctx, helper, instance,
+		&corev1.Secret{}, GetInventorySecretName(instance))
+	if err != nil || !isReleased {
+		return false, err
+	}
+
+	teardown := &dataplanev1.OpenStackDataPlaneDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetTeardownDeploymentName(instance),
+			Namespace: instance.Namespace,
+		},
+	}
+	err = helper.GetClient().Delete(ctx, teardown)
+	if err != nil && !k8s_errors.IsNotFound(err) {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// deleteOwnedObject deletes the named object when it is controlled by the
+// NodeSet, removing the finalizer of the NodeSet from it, and returns whether
+// it is gone
+func deleteOwnedObject(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet, obj client.Object, name string,
+) (bool, error) {
+	err := helper.GetClient().Get(ctx, types.NamespacedName{
+		Name:      name,
+		Namespace: instance.Namespace,
+	}, obj)
+	if k8s_errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !metav1.IsControlledBy(obj, instance) {
+		return true, nil
+	}
+	if controllerutil.RemoveFinalizer(obj, helper.GetFinalizer()) {
+		err = helper.GetClient().Update(ctx, obj)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	if obj.GetDeletionTimestamp().IsZero() {
+		helper.GetLogger().Info("Releasing NodeSet resource",
+			"kind", fmt.Sprintf("%T", obj), "name", name)
+		err = helper.GetClient().Delete(ctx, obj)
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
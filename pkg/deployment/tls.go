@@ -0,0 +1,99 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+
+	"golang.org/x/exp/slices"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
+)
+
+// TLSTransitionServiceTypes are the EDPM service types consuming TLS certs, in
+// the order they are reconfigured when TLS is enabled on a deployed NodeSet.
+var TLSTransitionServiceTypes = []string{
+	"ovn",
+	"libvirt",
+	"nova",
+	"neutron-metadata",
+	"neutron-ovn",
+	"neutron-sriov",
+	"neutron-dhcp",
+}
+
+// GetTLSTransitionServices returns the services to run, in order, to enable TLS
+// on an already deployed NodeSet. The certs are installed first, followed by the
+// services of the NodeSet consuming TLS certs, in the order of
+// TLSTransitionServiceTypes, and then by any other service of the NodeSet with
+// TLS certs.
+func GetTLSTransitionServices(ctx context.Context, helper *helper.Helper,
+	nodeSet *dataplanev1.OpenStackDataPlaneNodeSet,
+) ([]string, error) {
+	installers := []string{}
+	consumers := map[string][]string{}
+	others := []string{}
+	for _, serviceName := range nodeSet.Spec.Services {
+		service, err := GetService(ctx, helper, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		if service.Spec.AddCertMounts {
+			installers = append(installers, service.Name)
+		} else if slices.Contains(TLSTransitionServiceTypes, service.Spec.EDPMServiceType) {
+			consumers[service.Spec.EDPMServiceType] = append(consumers[service.Spec.EDPMServiceType], service.Name)
+		} else if service.Spec.TLSCerts != nil || service.Spec.CertsFrom != "" {
+			others = append(others, service.Name)
+		}
+	}
+	if len(installers) == 0 {
+		installers = append(installers, InstallCertsService)
+	}
+
+	services := installers
+	for _, serviceType := range TLSTransitionServiceTypes {
+		services = append(services, consumers[serviceType]...)
+	}
+	services = append(services, others...)
+
+	return services, nil
+}
+
+// GetTLSTransitionCondition returns the condition tracking the progress of the
+// TLS transition services on a NodeSet
+func GetTLSTransitionCondition(nsConditions condition.Conditions, tlsTransitionServices []string) *condition.Condition {
+	done := 0
+	for _, service := range tlsTransitionServices {
+		if nsConditions.IsTrue(GetServiceDeploymentReadyCondition(service)) {
+			done++
+		}
+	}
+	if done == len(tlsTransitionServices) {
+		return condition.TrueCondition(
+			dataplanev1.NodeSetTLSTransitionCondition,
+			dataplanev1.NodeSetTLSTransitionReadyMessage)
+	}
+
+	return condition.FalseCondition(
+		dataplanev1.NodeSetTLSTransitionCondition,
+		condition.RequestedReason,
+		condition.SeverityInfo,
+		dataplanev1.NodeSetTLSTransitionRunningMessage,
+		done, len(tlsTransitionServices))
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	infranetworkv1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/helper"
+)
+
+// NodeTopology is the hostname and the addresses of a node on each of its
+// networks, as published to Ansible in the topology group vars
+type NodeTopology struct {
+	HostName string                     `yaml:"hostname"`
+	Networks map[string]NetworkTopology `yaml:"networks"`
+}
+
+// NetworkTopology is the address of a node on a network, its addresses of
+// every IP family, and its hostnames
+type NetworkTopology struct {
+	IP         string   `yaml:"ip"`
+	IPs        []string `yaml:"ips"`
+	HostName   string   `yaml:"hostname,omitempty"`
+	DNSAliases []string `yaml:"dns_aliases,omitempty"`
+}
+
+// getNodeSetTopology returns the topology of the nodes of a NodeSet, keyed by
+// their inventory host name, from the AllHostnames, AllIPs, AllAddresses and
+// DNSAliases status
+func getNodeSetTopology(instance *dataplanev1.OpenStackDataPlaneNodeSet) map[string]NodeTopology {
+	topology := map[string]NodeTopology{}
+	for _, node := range getActiveNodes(instance) {
+		hostNames := instance.Status.AllHostnames[node.HostName]
+		addresses := getNodeAddresses(instance, node.HostName)
+		networks := map[string]NetworkTopology{}
+		for network, ip := range instance.Status.AllIPs[node.HostName] {
+			networks[string(network)] = NetworkTopology{
+				IP:         ip,
+				IPs:        addresses[network],
+				HostName:   hostNames[network],
+				DNSAliases: instance.Status.DNSAliases[node.HostName][network],
+			}
+		}
+		topology[strings.Split(node.HostName, ".")[0]] = NodeTopology{
+			HostName: node.HostName,
+			Networks: networks,
+		}
+	}
+	return topology
+}
+
+// getNodeAddresses returns the addresses of every IP family of a node, keyed by
+// network. The NodeSets whose AllAddresses status isn't recorded yet only
+// provide the AllIPs one.
+func getNodeAddresses(instance *dataplanev1.OpenStackDataPlaneNodeSet, hostName string) map[infranetworkv1.NetNameStr][]string {
+	if addresses, ok := instance.Status.AllAddresses[hostName]; ok {
+		return addresses
+	}
+	addresses := map[infranetworkv1.NetNameStr][]string{}
+	for network, ip := range instance.Status.AllIPs[hostName] {
+		addresses[network] = []string{ip}
+	}
+	return addresses
+}
+
+// NetworkSummary is the addresses and hostnames of the nodes of a NodeSet on
+// a network, as published to Ansible for all the NodeSets of the namespace
+type NetworkSummary struct {
+	IPs       []string `yaml:"ips"`
+	HostNames []string `yaml:"hostnames,omitempty"`
+}
+
+// getNodeSetSummary returns the sorted addresses and hostnames of the nodes
+// of a NodeSet, keyed by network
+func getNodeSetSummary(instance *dataplanev1.OpenStackDataPlaneNodeSet) map[string]NetworkSummary {
+	summary := map[string]NetworkSummary{}
+	for _, node := range getActiveNodes(instance) {
+		for network, ips := range getNodeAddresses(instance, node.HostName) {
+			networkSummary := summary[string(network)]
+			networkSummary.IPs = append(networkSummary.IPs, ips...)
+			if hostName := instance.Status.AllHostnames[node.HostName][network]; hostName != "" {
+				networkSummary.HostNames = append(networkSummary.HostNames, hostName)
+			}
+			networkSummary.HostNames = append(networkSummary.HostNames,
+				instance.Status.DNSAliases[node.HostName][network]...)
+			summary[string(network)] = networkSummary
+		}
+	}
+	for _, networkSummary := range summary {
+		sort.Strings(networkSummary.IPs)
+		sort.Strings(networkSummary.HostNames)
+	}
+	return summary
+}
+
+// getNodeSetsTopology returns the network summary of all the NodeSets of the
+// namespace of a NodeSet, keyed by NodeSet name. The NodeSet itself is taken
+// as given, as its status may not be recorded yet.
+func getNodeSetsTopology(ctx context.Context, helper *helper.Helper,
+	instance *dataplanev1.OpenStackDataPlaneNodeSet,
+) (map[string]map[string]NetworkSummary, error) {
+	nodeSets := &dataplanev1.OpenStackDataPlaneNodeSetList{}
+	err := helper.GetClient().List(ctx, nodeSets, client.InNamespace(instance.Namespace))
+	if err != nil {
+		return nil, err
+	}
+	topology := map[string]map[string]NetworkSummary{
+		instance.Name: getNodeSetSummary(instance),
+	}
+	for i := range nodeSets.Items {
+		nodeSet := &nodeSets.Items[i]
+		if nodeSet.Name == instance.Name || !nodeSet.DeletionTimestamp.IsZero() {
+			continue
+		}
+		topology[nodeSet.Name] = getNodeSetSummary(nodeSet)
+	}
+	return topology, nil
+}
+
+// IsTopologyChanged returns whether the hostnames or the addresses of the
+// nodes of a NodeSet, published to the other NodeSets, changed
+func IsTopologyChanged(oldNodeSet *dataplanev1.OpenStackDataPlaneNodeSet, newNodeSet *dataplanev1.OpenStackDataPlaneNodeSet) bool {
+	return !equality.Semantic.DeepEqual(getNodeSetSummary(oldNodeSet), getNodeSetSummary(newNodeSet))
+}
@@ -74,6 +74,11 @@ func AnsibleExecution(
 		}
 	}
 
+	serviceVars, err := getServiceAnsibleVars(ctx, helper, deployment.GetNamespace(), service)
+	if err != nil {
+		return err
+	}
+
 	_, err = controllerutil.CreateOrPatch(ctx, helper.GetClient(), ansibleEE, func() error {
 		ansibleEE.Spec.NetworkAttachments = aeeSpec.NetworkAttachments
 		if aeeSpec.DNSConfig != nil {
@@ -82,8 +87,15 @@ func AnsibleExecution(
 		if len(aeeSpec.OpenStackAnsibleEERunnerImage) > 0 {
 			ansibleEE.Spec.Image = aeeSpec.OpenStackAnsibleEERunnerImage
 		}
-		if len(aeeSpec.ExtraVars) > 0 {
-			ansibleEE.Spec.ExtraVars = aeeSpec.ExtraVars
+		// The ansible vars of the service take precedence over the ansible
+		// vars of the NodeSets, and the extra vars of the deployment take
+		// precedence over the ansible vars of the service
+		ansibleEE.Spec.ExtraVars = make(map[string]json.RawMessage)
+		for key, value := range serviceVars {
+			ansibleEE.Spec.ExtraVars[key] = value
+		}
+		for key, value := range aeeSpec.ExtraVars {
+			ansibleEE.Spec.ExtraVars[key] = value
 		}
 		if len(aeeSpec.AnsibleTags) > 0 {
 			fmt.Fprintf(&cmdLineArguments, "--tags %s ", aeeSpec.AnsibleTags)
@@ -108,14 +120,16 @@ func AnsibleExecution(
 			ansibleEE.Spec.Playbook = service.Spec.Playbook
 		}
 		ansibleEE.Spec.BackoffLimit = deployment.Spec.BackoffLimit
+		if service.Spec.BackoffLimit != nil {
+			ansibleEE.Spec.BackoffLimit = service.Spec.BackoffLimit
+		}
 
 		// If we have a service that ought to be deployed everywhere
 		// substitute the existing play target with 'all'
-		// Check if we have ExtraVars before accessing it
-		if ansibleEE.Spec.ExtraVars == nil {
-			ansibleEE.Spec.ExtraVars = make(map[string]json.RawMessage)
-		}
-		if service.Spec.DeployOnAllNodeSets {
+		if aeeSpec.OverrideHosts != "" {
+			// The hooks running on the ansible runner target localhost
+			ansibleEE.Spec.ExtraVars["edpm_override_hosts"] = json.RawMessage([]byte(fmt.Sprintf("\"%s\"", aeeSpec.OverrideHosts)))
+		} else if service.Spec.DeployOnAllNodeSets {
 			ansibleEE.Spec.ExtraVars["edpm_override_hosts"] = json.RawMessage([]byte("\"all\""))
 			util.LogForObject(helper, fmt.Sprintf("for service %s, substituting existing ansible play host with 'all'.", service.Name), ansibleEE)
 		} else {
@@ -240,6 +254,46 @@ func AnsibleExecution(
 	return nil
 }
 
+// getServiceAnsibleVars gets the ansible vars of a service from its
+// AnsibleVarsFrom sources, then from its AnsibleVars which take precedence
+func getServiceAnsibleVars(ctx context.Context, helper *helper.Helper, namespace string,
+	service *dataplanev1.OpenStackDataPlaneService,
+) (map[string]json.RawMessage, error) {
+	result := make(map[string]json.RawMessage)
+
+	for _, dataSource := range service.Spec.AnsibleVarsFrom {
+		configMap, secret, err := GetDataSourceCmSecret(ctx, helper, namespace, dataSource)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]string)
+		if configMap != nil {
+			for k, v := range configMap.Data {
+				values[k] = v
+			}
+		}
+		if secret != nil {
+			for k, v := range secret.Data {
+				values[k] = string(v)
+			}
+		}
+		for k, v := range values {
+			value, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			result[dataSource.Prefix+k] = value
+		}
+	}
+
+	for k, v := range service.Spec.AnsibleVars {
+		result[k] = v
+	}
+
+	return result, nil
+}
+
 // GetAnsibleExecution gets and returns an OpenStackAnsibleEE with the given
 // labels where
 // "openstackdataplaneservice":    <serviceName>,
@@ -1,8 +1,18 @@
 package functional
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"time"
 
+	metal3v1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	. "github.com/onsi/gomega" //revive:disable:dot-imports
 	"gopkg.in/yaml.v3"
 	corev1 "k8s.io/api/core/v1"
@@ -12,6 +22,7 @@ import (
 
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
 	infrav1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
+	"github.com/openstack-k8s-operators/lib-common/modules/certmanager"
 	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
 	"github.com/openstack-k8s-operators/openstack-ansibleee-operator/api/v1beta1"
 )
@@ -101,6 +112,61 @@ func CreateDNSMasq(name types.NamespacedName, spec map[string]interface{}) *unst
 	return th.CreateUnstructured(raw)
 }
 
+// Create the issuer of the internal TLS certs of the nodes
+func CreateRootCAIssuer(name types.NamespacedName) *unstructured.Unstructured {
+	raw := map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Issuer",
+		"metadata": map[string]interface{}{
+			"name":      name.Name,
+			"namespace": name.Namespace,
+			"labels": map[string]interface{}{
+				certmanager.RootCAIssuerInternalLabel: "",
+			},
+		},
+		"spec": map[string]interface{}{
+			"ca": map[string]interface{}{
+				"secretName": name.Name,
+			},
+		},
+	}
+	return th.CreateUnstructured(raw)
+}
+
+// Create the secret of the TLS cert of a service issued for a node, as
+// cert-manager would, with files of the given size
+func CreateNodeCertSecret(namespace string, serviceName string, certKey string, hostName string, size int) *corev1.Secret {
+	return th.CreateSecret(
+		types.NamespacedName{
+			Namespace: namespace,
+			Name:      fmt.Sprintf("cert-%s-%s-%s", serviceName, certKey, hostName),
+		},
+		map[string][]byte{
+			"tls.key": bytes.Repeat([]byte("k"), size),
+			"tls.crt": bytes.Repeat([]byte("c"), size),
+			"ca.crt":  bytes.Repeat([]byte("a"), size),
+		},
+	)
+}
+
+// Generate a self-signed PEM encoded CA cert
+func GenerateCACert(commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
 // Create SSHSecret
 func CreateSSHSecret(name types.NamespacedName) *corev1.Secret {
 	return th.CreateSecret(
@@ -202,6 +268,43 @@ func DefaultNetConfigSpec() map[string]interface{} {
 	}
 }
 
+// IPv6NetConfigSpec returns a NetConfig with an IPv6 only ctlplane network
+func IPv6NetConfigSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"networks": []map[string]interface{}{{
+			"dnsDomain": "test-domain.test",
+			"mtu":       1500,
+			"name":      "CtlPLane",
+			"subnets": []map[string]interface{}{
+				ipv6SubnetSpec(),
+			},
+		},
+		},
+	}
+}
+
+// DualStackNetConfigSpec returns a NetConfig with an IPv4 and an IPv6 subnet
+// on the ctlplane network
+func DualStackNetConfigSpec() map[string]interface{} {
+	spec := DefaultNetConfigSpec()
+	network := spec["networks"].([]map[string]interface{})[0]
+	network["subnets"] = append(network["subnets"].([]map[string]interface{}), ipv6SubnetSpec())
+	return spec
+}
+
+func ipv6SubnetSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"allocationRanges": []map[string]interface{}{{
+			"end":   "fd00:fd00:fd00:2000::120",
+			"start": "fd00:fd00:fd00:2000::10",
+		},
+		},
+		"name":    "subnet2",
+		"cidr":    "fd00:fd00:fd00:2000::/64",
+		"gateway": "fd00:fd00:fd00:2000::1",
+	}
+}
+
 func DefaultDNSMasqSpec() map[string]interface{} {
 	return map[string]interface{}{
 		"replicas": 1,
@@ -237,20 +340,15 @@ func SimulateDNSDataComplete(name types.NamespacedName) {
 
 // SimulateIPSetComplete - Simulates the result of the IPSet status
 func SimulateIPSetComplete(name types.NamespacedName) {
+	SimulateIPSetReservations(name, []infrav1.IPSetReservation{IPv4Reservation()})
+}
+
+// SimulateIPSetReservations - Simulates the IPSet status with the given reservations
+func SimulateIPSetReservations(name types.NamespacedName, reservations []infrav1.IPSetReservation) {
 	Eventually(func(g Gomega) {
 		IPSet := &infrav1.IPSet{}
 		g.Expect(th.K8sClient.Get(th.Ctx, name, IPSet)).Should(Succeed())
-		gateway := "172.20.12.1"
-		IPSet.Status.Reservation = []infrav1.IPSetReservation{
-			{
-				Address: "172.20.12.76",
-				Cidr:    "172.20.12.0/16",
-				MTU:     1500,
-				Network: "CtlPlane",
-				Subnet:  "subnet1",
-				Gateway: &gateway,
-			},
-		}
+		IPSet.Status.Reservation = reservations
 		// This can return conflict so we have the gomega.Eventually block to retry
 		g.Expect(th.K8sClient.Status().Update(th.Ctx, IPSet)).To(Succeed())
 
@@ -259,6 +357,64 @@ func SimulateIPSetComplete(name types.NamespacedName) {
 	th.Logger.Info("Simulated IPSet creation completed", "on", name)
 }
 
+// CreateBaremetalHost - Creates an available BaremetalHost, optionally consumed by the given object
+func CreateBaremetalHost(name types.NamespacedName, labels map[string]string, consumerRef *corev1.ObjectReference) *metal3v1.BareMetalHost {
+	bmh := &metal3v1.BareMetalHost{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+			Labels:    labels,
+		},
+		Spec: metal3v1.BareMetalHostSpec{
+			ConsumerRef: consumerRef,
+		},
+	}
+	Expect(th.K8sClient.Create(th.Ctx, bmh)).Should(Succeed())
+	Eventually(func(g Gomega) {
+		g.Expect(th.K8sClient.Get(th.Ctx, name, bmh)).Should(Succeed())
+		bmh.Status.Provisioning.State = metal3v1.StateAvailable
+		g.Expect(th.K8sClient.Status().Update(th.Ctx, bmh)).To(Succeed())
+	}, th.Timeout, th.Interval).Should(Succeed())
+
+	return bmh
+}
+
+// TriggerNodeSetReconcile - Changes an annotation of the NodeSet to have it reconciled again
+func TriggerNodeSetReconcile(name types.NamespacedName) {
+	Eventually(func(g Gomega) {
+		instance := &dataplanev1.OpenStackDataPlaneNodeSet{}
+		g.Expect(th.K8sClient.Get(th.Ctx, name, instance)).Should(Succeed())
+		instance.SetAnnotations(map[string]string{"test/reconcile": instance.ResourceVersion})
+		g.Expect(th.K8sClient.Update(th.Ctx, instance)).To(Succeed())
+	}, th.Timeout, th.Interval).Should(Succeed())
+}
+
+// IPv4Reservation - Returns a ctlplane reservation from the IPv4 subnet
+func IPv4Reservation() infrav1.IPSetReservation {
+	gateway := "172.20.12.1"
+	return infrav1.IPSetReservation{
+		Address: "172.20.12.76",
+		Cidr:    "172.20.12.0/16",
+		MTU:     1500,
+		Network: "CtlPlane",
+		Subnet:  "subnet1",
+		Gateway: &gateway,
+	}
+}
+
+// IPv6Reservation - Returns a ctlplane reservation from the IPv6 subnet
+func IPv6Reservation() infrav1.IPSetReservation {
+	gateway := "fd00:fd00:fd00:2000::1"
+	return infrav1.IPSetReservation{
+		Address: "fd00:fd00:fd00:2000::76",
+		Cidr:    "fd00:fd00:fd00:2000::/64",
+		MTU:     1500,
+		Network: "CtlPlane",
+		Subnet:  "subnet2",
+		Gateway: &gateway,
+	}
+}
+
 // Build OpenStackDataPlaneNodeSet struct and fill it with preset values
 func DefaultDataplaneNodeSetTemplate(name types.NamespacedName, spec map[string]interface{}) map[string]interface{} {
 	return map[string]interface{}{
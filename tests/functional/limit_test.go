@@ -0,0 +1,84 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package functional
+
+import (
+	. "github.com/onsi/ginkgo/v2" //revive:disable:dot-imports
+	. "github.com/onsi/gomega"    //revive:disable:dot-imports
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	"github.com/openstack-k8s-operators/dataplane-operator/pkg/deployment"
+)
+
+var _ = Describe("Ansible limit", func() {
+	nodeSet := &dataplanev1.OpenStackDataPlaneNodeSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "edpm-compute-nodeset",
+		},
+		Spec: dataplanev1.OpenStackDataPlaneNodeSetSpec{
+			Nodes: map[string]dataplanev1.NodeSection{
+				"compute-0":   {HostName: "compute-0.example.com"},
+				"compute-1":   {HostName: "compute-1"},
+				"networker-0": {HostName: "networker-0.example.com"},
+			},
+		},
+	}
+	allHosts := []string{"compute-0.example.com", "compute-1", "networker-0.example.com"}
+
+	DescribeTable("Should target the nodes of the NodeSet matching the limit",
+		func(limit string, expectedHosts []string) {
+			hosts, resolved, err := deployment.GetTargetedHosts(nodeSet, limit)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resolved).Should(BeTrue())
+			Expect(hosts).Should(Equal(expectedHosts))
+		},
+		Entry("no limit", "", allHosts),
+		Entry("the all group", "all", allHosts),
+		Entry("the NodeSet group", "edpm-compute-nodeset", allHosts),
+		Entry("a short host name", "compute-0", []string{"compute-0.example.com"}),
+		Entry("a fully qualified host name", "compute-0.example.com", []string{"compute-0.example.com"}),
+		Entry("a list of hosts", "compute-1,networker-0", []string{"compute-1", "networker-0.example.com"}),
+		Entry("a list of hosts separated by colons", "compute-1:networker-0", []string{"compute-1", "networker-0.example.com"}),
+		Entry("a wildcard", "compute-*", []string{"compute-0.example.com", "compute-1"}),
+		Entry("an exclusion from all", "all,!compute-1", []string{"compute-0.example.com", "networker-0.example.com"}),
+		Entry("an exclusion alone", "!compute-1", []string{"compute-0.example.com", "networker-0.example.com"}),
+		Entry("an intersection", "compute-*,&*.example.com", []string{"compute-0.example.com"}),
+		Entry("a regular expression", "~compute-[01]", []string{"compute-0.example.com", "compute-1"}),
+		Entry("a regular expression matched at the start of the names", "~ute-1", []string{}),
+		Entry("a regular expression matching the whole name", "~.*ute-1", []string{"compute-1"}),
+		Entry("a wildcard matching no host", "ceph-*", []string{}),
+	)
+
+	DescribeTable("Should report the limits that can't be resolved against the NodeSet",
+		func(limit string, expectedHosts []string) {
+			hosts, resolved, err := deployment.GetTargetedHosts(nodeSet, limit)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resolved).Should(BeFalse())
+			Expect(hosts).Should(Equal(expectedHosts))
+		},
+		Entry("another group", "other-nodeset", []string{}),
+		Entry("another group along with a host", "compute-0,other-nodeset", []string{"compute-0.example.com"}),
+		Entry("an exclusion of another group", "all:!other-nodeset", allHosts),
+		Entry("a group subscript", "edpm-compute-nodeset[0:1]", []string{}),
+		Entry("a limit file", "@retry_hosts", []string{}),
+	)
+
+	It("Should reject an invalid regular expression", func() {
+		_, _, err := deployment.GetTargetedHosts(nodeSet, "~compute-[")
+		Expect(err).Should(HaveOccurred())
+	})
+})
@@ -1,14 +1,18 @@
 package functional
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 
 	. "github.com/onsi/ginkgo/v2" //revive:disable:dot-imports
 	. "github.com/onsi/gomega"    //revive:disable:dot-imports
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	"github.com/openstack-k8s-operators/dataplane-operator/pkg/deployment"
 	dataplaneutil "github.com/openstack-k8s-operators/dataplane-operator/pkg/util"
+	infrav1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
+	"github.com/openstack-k8s-operators/lib-common/modules/common/tls"
 
 	//revive:disable-next-line:dot-imports
 	. "github.com/openstack-k8s-operators/lib-common/modules/common/test/helpers"
@@ -242,6 +246,1082 @@ var _ = Describe("Dataplane Deployment Test", func() {
 		})
 	})
 
+	When("A dataplaneDeployment is created with a service having TLS certs for several nodes", func() {
+		var deploymentSpec map[string]interface{}
+
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			DeferCleanup(th.DeleteInstance, CreateRootCAIssuer(types.NamespacedName{
+				Name:      "rootca-internal",
+				Namespace: namespace,
+			}))
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook":      "osp.edpm.foo",
+				"addCertMounts": true,
+				"tlsCerts": map[string]interface{}{
+					"default": map[string]interface{}{
+						"contents": []string{"dnsnames"},
+					},
+				},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+
+			// The files of a node take 431 bytes in the certs secrets, the
+			// 131 bytes of their names and 3 times 100 bytes of content, so
+			// that only the files of two nodes fit in a secret
+			nodeSetSpec := DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)
+			nodeSetSpec["secretMaxSize"] = 1000
+			nodes := map[string]interface{}{}
+			for i := 1; i <= 3; i++ {
+				hostName := fmt.Sprintf("edpm-compute-node-%d", i)
+				nodes[fmt.Sprintf("%s-node-%d", dataplaneNodeSetName.Name, i)] = map[string]interface{}{
+					"hostName": hostName,
+					"networks": []infrav1.IPSetNetwork{
+						{Name: "ctlplane", SubnetName: "subnet1"},
+					},
+				}
+				DeferCleanup(th.DeleteInstance, CreateNodeCertSecret(namespace, dataplaneServiceName.Name, "default", hostName, 100))
+			}
+			nodeSetSpec["nodes"] = nodes
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			for i := 1; i <= 3; i++ {
+				reservation := IPv4Reservation()
+				reservation.Address = fmt.Sprintf("172.20.12.%d", 75+i)
+				reservation.DNSDomain = "test-domain.test"
+				SimulateIPSetReservations(types.NamespacedName{
+					Name:      fmt.Sprintf("edpm-compute-node-%d", i),
+					Namespace: namespace,
+				}, []infrav1.IPSetReservation{reservation})
+			}
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			deploymentSpec = DefaultDataPlaneDeploymentSpec()
+		})
+
+		JustBeforeEach(func() {
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, deploymentSpec))
+		})
+
+		It("Should pack the certs of the nodes into as few secrets as possible", func() {
+			Eventually(func(g Gomega) {
+				nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(nodeSet.Status.ServiceCertSecrets).Should(HaveKeyWithValue(
+					"foo-service/default", []dataplanev1.ServiceCertSecret{
+						{
+							Name:  "edpm-compute-nodeset-foo-service-default-certs-0",
+							Hosts: []string{"edpm-compute-node-1", "edpm-compute-node-2"},
+						},
+						{
+							Name:  "edpm-compute-nodeset-foo-service-default-certs-1",
+							Hosts: []string{"edpm-compute-node-3"},
+						},
+					}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			certsSecret := th.GetSecret(types.NamespacedName{
+				Name:      "edpm-compute-nodeset-foo-service-default-certs-0",
+				Namespace: namespace,
+			})
+			Expect(certsSecret.Data).Should(HaveLen(6))
+			Expect(certsSecret.Data).Should(HaveKey("edpm-compute-node-2.test-domain.test-tls.crt"))
+			certsSecret = th.GetSecret(types.NamespacedName{
+				Name:      "edpm-compute-nodeset-foo-service-default-certs-1",
+				Namespace: namespace,
+			})
+			Expect(certsSecret.Data).Should(HaveLen(3))
+			Expect(certsSecret.Data).Should(HaveKey("edpm-compute-node-3.test-domain.test-tls.crt"))
+		})
+
+		When("A certs secret has the labels set by a previous version", func() {
+			BeforeEach(func() {
+				Expect(th.K8sClient.Create(th.Ctx, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "edpm-compute-nodeset-foo-service-default-certs-0",
+						Namespace: namespace,
+						Labels: map[string]string{
+							"numberOfSecrets": "1",
+							"secretNumber":    "0",
+						},
+					},
+				})).Should(Succeed())
+			})
+
+			It("Should remove the labels which are no longer set", func() {
+				Eventually(func(g Gomega) {
+					certsSecret := &corev1.Secret{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      "edpm-compute-nodeset-foo-service-default-certs-0",
+						Namespace: namespace,
+					}, certsSecret)).Should(Succeed())
+					g.Expect(certsSecret.Data).Should(HaveLen(6))
+					g.Expect(certsSecret.Labels).ShouldNot(HaveKey("numberOfSecrets"))
+					g.Expect(certsSecret.Labels).Should(HaveKeyWithValue("secretNumber", "0"))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+
+		When("One of the nodes is being removed", func() {
+			BeforeEach(func() {
+				removingNodeName := fmt.Sprintf("%s-node-3", dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+					instance.Spec.Removal = []string{dataplaneServiceName.Name}
+					node := instance.Spec.Nodes[removingNodeName]
+					node.State = dataplanev1.NodeStateRemoving
+					instance.Spec.Nodes[removingNodeName] = node
+					g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+				DeferCleanup(func() {
+					Eventually(func(g Gomega) {
+						removal := &dataplanev1.OpenStackDataPlaneDeployment{}
+						g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+							Name:      fmt.Sprintf("%s-remove-%s", dataplaneNodeSetName.Name, removingNodeName),
+							Namespace: namespace,
+						}, removal)).Should(Succeed())
+						th.DeleteInstance(removal)
+					}, th.Timeout, th.Interval).Should(Succeed())
+				})
+			})
+
+			It("Should keep the certs of all the nodes in the same secrets", func() {
+				expectedCertSecrets := []dataplanev1.ServiceCertSecret{
+					{
+						Name:  "edpm-compute-nodeset-foo-service-default-certs-0",
+						Hosts: []string{"edpm-compute-node-1", "edpm-compute-node-2"},
+					},
+					{
+						Name:  "edpm-compute-nodeset-foo-service-default-certs-1",
+						Hosts: []string{"edpm-compute-node-3"},
+					},
+				}
+				Eventually(func(g Gomega) {
+					nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+					g.Expect(nodeSet.Status.ServiceCertSecrets).Should(HaveKeyWithValue(
+						"foo-service/default", expectedCertSecrets))
+				}, th.Timeout, th.Interval).Should(Succeed())
+				// The regular and the removal deployments don't repack the
+				// secrets with their own nodes
+				Consistently(func(g Gomega) {
+					nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+					g.Expect(nodeSet.Status.ServiceCertSecrets).Should(HaveKeyWithValue(
+						"foo-service/default", expectedCertSecrets))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+
+		When("The deployment is limited to one of the nodes", func() {
+			BeforeEach(func() {
+				deploymentSpec["ansibleLimit"] = "edpm-compute-node-2"
+			})
+
+			It("Should only mount the certs of the targeted node", func() {
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					GetService(dataplaneServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					var certVolume *corev1.Volume
+					for _, extraMount := range ansibleEE.Spec.ExtraMounts {
+						for i, volume := range extraMount.Volumes {
+							if volume.Name == "edpm-compute-nodeset-foo-service-default-certs-0" {
+								certVolume = &extraMount.Volumes[i]
+							}
+						}
+					}
+					g.Expect(certVolume).ToNot(BeNil())
+					g.Expect(certVolume.Projected).ToNot(BeNil())
+					g.Expect(certVolume.Projected.Sources).Should(HaveLen(1))
+					certsSecret := certVolume.Projected.Sources[0].Secret
+					g.Expect(certsSecret.Name).Should(Equal("edpm-compute-nodeset-foo-service-default-certs-0"))
+					g.Expect(certsSecret.Items).Should(Equal([]corev1.KeyToPath{
+						{Key: "edpm-compute-node-2.test-domain.test-ca.crt", Path: "edpm-compute-node-2.test-domain.test-ca.crt"},
+						{Key: "edpm-compute-node-2.test-domain.test-tls.crt", Path: "edpm-compute-node-2.test-domain.test-tls.crt"},
+						{Key: "edpm-compute-node-2.test-domain.test-tls.key", Path: "edpm-compute-node-2.test-domain.test-tls.key"},
+					}))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+
+		When("The deployment is limited with a group unknown to the NodeSet", func() {
+			BeforeEach(func() {
+				deploymentSpec["ansibleLimit"] = "edpm-compute-node-2,other-nodeset"
+			})
+
+			It("Should mount the certs of all the nodes", func() {
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					GetService(dataplaneServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					var certVolume *corev1.Volume
+					for _, extraMount := range ansibleEE.Spec.ExtraMounts {
+						for i, volume := range extraMount.Volumes {
+							if volume.Name == "edpm-compute-nodeset-foo-service-default-certs-0" {
+								certVolume = &extraMount.Volumes[i]
+							}
+						}
+					}
+					g.Expect(certVolume).ToNot(BeNil())
+					g.Expect(certVolume.Projected).ToNot(BeNil())
+					g.Expect(certVolume.Projected.Sources).Should(HaveLen(1))
+					certsSecret := certVolume.Projected.Sources[0].Secret
+					g.Expect(certsSecret.Name).Should(Equal("edpm-compute-nodeset-foo-service-default-certs-0"))
+					g.Expect(certsSecret.Items).Should(BeEmpty())
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+	})
+
+	When("A dataplaneDeployment is created after TLS is enabled on a deployed NodeSet", func() {
+		var ovnServiceName types.NamespacedName
+		var installCertsServiceName types.NamespacedName
+
+		BeforeEach(func() {
+			ovnServiceName = types.NamespacedName{
+				Name:      "custom-ovn",
+				Namespace: namespace,
+			}
+			installCertsServiceName = types.NamespacedName{
+				Name:      "custom-install-certs",
+				Namespace: namespace,
+			}
+			CreateSSHSecret(dataplaneSSHSecretName)
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook": "osp.edpm.foo",
+			})
+			CreateDataPlaneServiceFromSpec(ovnServiceName, map[string]interface{}{
+				"playbook":        "osp.edpm.ovn",
+				"EDPMServiceType": "ovn",
+			})
+			CreateDataPlaneServiceFromSpec(installCertsServiceName, map[string]interface{}{
+				"playbook":      "osp.edpm.install_certs",
+				"addCertMounts": true,
+			})
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, ovnServiceName)
+			DeferCleanup(th.DeleteService, installCertsServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			nodeSetSpec := DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)
+			nodeSetSpec["tlsEnabled"] = false
+			nodeSetSpec["services"] = []string{
+				dataplaneServiceName.Name,
+				ovnServiceName.Name,
+				installCertsServiceName.Name,
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			// The NodeSet was deployed without TLS
+			Eventually(func(g Gomega) {
+				nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+				tlsEnabled := false
+				nodeSet.Status.DeployedConfigHash = "deployed"
+				nodeSet.Status.DeployedTLSEnabled = &tlsEnabled
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, nodeSet)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Eventually(func(g Gomega) {
+				nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+				nodeSet.Spec.TLSEnabled = true
+				g.Expect(th.K8sClient.Update(th.Ctx, nodeSet)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should reconfigure the TLS consuming services first and track the transition", func() {
+			th.ExpectConditionWithDetails(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetTLSTransitionCondition,
+				corev1.ConditionFalse,
+				condition.RequestedReason,
+				dataplanev1.NodeSetTLSTransitionPendingMessage,
+			)
+
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, DefaultDataPlaneDeploymentSpec()))
+
+			// The certs are installed first, then the ovn service is
+			// reconfigured, and only then the other services are deployed
+			orderedServices := []types.NamespacedName{
+				installCertsServiceName,
+				ovnServiceName,
+				dataplaneServiceName,
+			}
+			for i, serviceName := range orderedServices {
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					GetService(serviceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					ansibleEE.Status.JobStatus = ansibleeev1.JobStatusSucceeded
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+
+				for _, nextServiceName := range orderedServices[i+1:] {
+					nextAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+						GetService(nextServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+					Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      nextAEEName,
+						Namespace: namespace,
+					}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+				}
+			}
+
+			th.ExpectCondition(
+				dataplaneDeploymentName,
+				ConditionGetterFunc(DataplaneDeploymentConditionGetter),
+				condition.ReadyCondition,
+				corev1.ConditionTrue,
+			)
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				g.Expect(nsConditions.IsTrue(dataplanev1.NodeSetTLSTransitionCondition)).To(BeTrue())
+				nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(nodeSet.Status.DeployedTLSEnabled).ToNot(BeNil())
+				g.Expect(*nodeSet.Status.DeployedTLSEnabled).To(BeTrue())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetTLSTransitionCondition,
+				corev1.ConditionTrue,
+			)
+		})
+
+		It("Should only run the overridden services and keep the transition pending", func() {
+			deploymentSpec := DefaultDataPlaneDeploymentSpec()
+			deploymentSpec["servicesOverride"] = []string{
+				dataplaneServiceName.Name,
+				ovnServiceName.Name,
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, deploymentSpec))
+
+			// The ovn service is reconfigured before the other overridden
+			// service, and the certs are not installed
+			orderedServices := []types.NamespacedName{
+				ovnServiceName,
+				dataplaneServiceName,
+			}
+			for i, serviceName := range orderedServices {
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					GetService(serviceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					ansibleEE.Status.JobStatus = ansibleeev1.JobStatusSucceeded
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+
+				for _, nextServiceName := range orderedServices[i+1:] {
+					nextAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+						GetService(nextServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+					Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      nextAEEName,
+						Namespace: namespace,
+					}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+				}
+			}
+
+			th.ExpectCondition(
+				dataplaneDeploymentName,
+				ConditionGetterFunc(DataplaneDeploymentConditionGetter),
+				condition.ReadyCondition,
+				corev1.ConditionTrue,
+			)
+			installCertsAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				GetService(installCertsServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+				Name:      installCertsAEEName,
+				Namespace: namespace,
+			}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+			Eventually(func(g Gomega) {
+				nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(nodeSet.IsTLSTransitionPending()).To(BeTrue())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetTLSTransitionCondition,
+				corev1.ConditionFalse,
+			)
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having ansible vars", func() {
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			serviceVarsConfigMapName := types.NamespacedName{
+				Namespace: namespace,
+				Name:      "foo-service-vars",
+			}
+			DeferCleanup(th.DeleteInstance, th.CreateConfigMap(serviceVarsConfigMapName, map[string]interface{}{
+				"foo_from":     "configmap",
+				"foo_override": "configmap",
+			}))
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"ansibleVars": map[string]interface{}{
+					"foo_override":   "service",
+					"foo_deployment": "service",
+				},
+				"ansibleVarsFrom": []map[string]interface{}{{
+					"prefix": "edpm_",
+					"configMapRef": map[string]interface{}{
+						"name": serviceVarsConfigMapName.Name,
+					},
+				}, {
+					"configMapRef": map[string]interface{}{
+						"name": serviceVarsConfigMapName.Name,
+					},
+				}},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			deploymentSpec := DefaultDataPlaneDeploymentSpec()
+			deploymentSpec["ansibleExtraVars"] = map[string]interface{}{
+				"foo_deployment": "deployment",
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, deploymentSpec))
+		})
+
+		It("Should pass the ansible vars of the service as extra vars", func() {
+			service := GetService(dataplaneServiceName)
+			aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				service, dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Eventually(func(g Gomega) {
+				ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+				g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+					Name:      aeeName,
+					Namespace: namespace,
+				}, ansibleEE)).To(Succeed())
+				g.Expect(string(ansibleEE.Spec.ExtraVars["edpm_foo_from"])).To(Equal("\"configmap\""))
+				g.Expect(string(ansibleEE.Spec.ExtraVars["foo_from"])).To(Equal("\"configmap\""))
+				g.Expect(string(ansibleEE.Spec.ExtraVars["foo_override"])).To(Equal("\"service\""))
+				g.Expect(string(ansibleEE.Spec.ExtraVars["foo_deployment"])).To(Equal("\"deployment\""))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should record the hash of the ansible vars of the service", func() {
+			nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+			for _, serviceName := range nodeSet.Spec.Services {
+				service := GetService(types.NamespacedName{Name: serviceName, Namespace: namespace})
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					service, dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					ansibleEE.Status.JobStatus = ansibleeev1.JobStatusSucceeded
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+			}
+
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneDeployment(dataplaneDeploymentName)
+				g.Expect(instance.Status.ConfigMapHashes).To(HaveKey("foo-service-vars"))
+				g.Expect(instance.Status.AnsibleVarsHashes).To(HaveKey(dataplaneServiceName.Name))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having CA certs sources", func() {
+		var caCerts [][]byte
+		var caSourceNames []types.NamespacedName
+		var bundleName types.NamespacedName
+
+		// completeDeployment marks the executions of all the services of the
+		// NodeSet as succeeded
+		completeDeployment := func(deploymentName types.NamespacedName) {
+			nodeSet := GetDataplaneNodeSet(dataplaneNodeSetName)
+			for _, serviceName := range nodeSet.Spec.Services {
+				service := GetService(types.NamespacedName{Name: serviceName, Namespace: namespace})
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					service, deploymentName.Name, dataplaneNodeSetName.Name)
+				Eventually(func(g Gomega) {
+					ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					ansibleEE.Status.JobStatus = ansibleeev1.JobStatusSucceeded
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+			}
+		}
+
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			caCerts = [][]byte{GenerateCACert("ca-1"), GenerateCACert("ca-2"), GenerateCACert("ca-3")}
+			caSourceNames = []types.NamespacedName{
+				{Namespace: namespace, Name: "ca-source-1"},
+				{Namespace: namespace, Name: "ca-source-2"},
+			}
+			// The second CA cert is in both sources
+			DeferCleanup(th.DeleteInstance, th.CreateSecret(caSourceNames[0], map[string][]byte{
+				"ca.crt": bytes.Join(caCerts[:2], nil),
+			}))
+			DeferCleanup(th.DeleteInstance, th.CreateSecret(caSourceNames[1], map[string][]byte{
+				"ca.crt": bytes.Join(caCerts[1:], nil),
+			}))
+			bundleName = types.NamespacedName{
+				Namespace: namespace,
+				Name:      fmt.Sprintf("%s-cacerts-bundle", dataplaneServiceName.Name),
+			}
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook": "osp.edpm.foo",
+				"caCertsFrom": []map[string]interface{}{{
+					"secretRef": map[string]interface{}{
+						"name": caSourceNames[0].Name,
+					},
+				}, {
+					"secretRef": map[string]interface{}{
+						"name": caSourceNames[1].Name,
+					},
+				}},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, DefaultDataPlaneDeploymentSpec()))
+		})
+
+		It("Should bundle the CA certs of the sources once and hash the bundle", func() {
+			Eventually(func(g Gomega) {
+				bundle := th.GetSecret(bundleName)
+				g.Expect(bundle.Data[tls.CABundleKey]).To(Equal(bytes.Join(caCerts, nil)))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			completeDeployment(dataplaneDeploymentName)
+			var bundleHash string
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneDeployment(dataplaneDeploymentName)
+				g.Expect(instance.Status.SecretHashes).To(HaveKey(bundleName.Name))
+				bundleHash = instance.Status.SecretHashes[bundleName.Name]
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			// A new CA cert in one of the sources changes the bundle, and the
+			// hash recorded by the next deployment
+			caCerts = append(caCerts, GenerateCACert("ca-4"))
+			Eventually(func(g Gomega) {
+				source := th.GetSecret(caSourceNames[1])
+				source.Data["ca.crt"] = bytes.Join(caCerts[1:], nil)
+				g.Expect(th.K8sClient.Update(th.Ctx, &source)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			nextDeploymentName := types.NamespacedName{
+				Namespace: namespace,
+				Name:      "edpm-deployment-ca-update",
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(nextDeploymentName, DefaultDataPlaneDeploymentSpec()))
+			Eventually(func(g Gomega) {
+				bundle := th.GetSecret(bundleName)
+				g.Expect(bundle.Data[tls.CABundleKey]).To(Equal(bytes.Join(caCerts, nil)))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			completeDeployment(nextDeploymentName)
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneDeployment(nextDeploymentName)
+				g.Expect(instance.Status.SecretHashes).To(HaveKey(bundleName.Name))
+				g.Expect(instance.Status.SecretHashes[bundleName.Name]).ToNot(Equal(bundleHash))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having hooks", func() {
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook": "osp.edpm.foo",
+				"preHooks": []map[string]interface{}{{
+					"name":             "disable",
+					"playbookContents": "- hosts: localhost\n  tasks: []\n",
+					"runOn":            "runner",
+				}},
+				"postHooks": []map[string]interface{}{{
+					"name":     "smoke-test",
+					"playbook": "osp.edpm.foo_smoke_test",
+				}},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, DefaultDataPlaneDeploymentSpec()))
+		})
+
+		It("Should run the hooks before and after the service", func() {
+			service := GetService(dataplaneServiceName)
+			completeExecution := func(executionService *dataplanev1.OpenStackDataPlaneService) *ansibleeev1.OpenStackAnsibleEE {
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					executionService, dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+				Eventually(func(g Gomega) {
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					ansibleEE.Status.JobStatus = ansibleeev1.JobStatusSucceeded
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+				return ansibleEE
+			}
+			preHookService := service.DeepCopy()
+			preHookService.Name = "foo-service-pre-disable"
+			postHookService := service.DeepCopy()
+			postHookService.Name = "foo-service-post-smoke-test"
+
+			serviceAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				service, dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Consistently(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+					Name:      serviceAEEName,
+					Namespace: namespace,
+				}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			preHookAEE := completeExecution(preHookService)
+			Expect(preHookAEE.Spec.Play).Should(ContainSubstring("hosts: localhost"))
+			Expect(string(preHookAEE.Spec.ExtraVars["edpm_override_hosts"])).Should(Equal("\"localhost\""))
+			Expect(string(preHookAEE.Spec.ExtraVars["edpm_service_type"])).Should(Equal("\"foo-service\""))
+
+			serviceAEE := completeExecution(service)
+			Expect(serviceAEE.Spec.Playbook).Should(Equal("osp.edpm.foo"))
+
+			postHookAEE := completeExecution(postHookService)
+			Expect(postHookAEE.Spec.Playbook).Should(Equal("osp.edpm.foo_smoke_test"))
+			Expect(string(postHookAEE.Spec.ExtraVars["edpm_override_hosts"])).Should(Equal(fmt.Sprintf("\"%s\"", dataplaneNodeSetName.Name)))
+
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				g.Expect(nsConditions.IsTrue(deployment.GetServiceHookReadyCondition("foo-service", "pre", "disable"))).To(BeTrue())
+				g.Expect(nsConditions.IsTrue(deployment.GetServiceHookReadyCondition("foo-service", "post", "smoke-test"))).To(BeTrue())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having a health check", func() {
+		var healthCheckService *dataplanev1.OpenStackDataPlaneService
+		var setExecutionStatus func(*dataplanev1.OpenStackDataPlaneService, string) *ansibleeev1.OpenStackAnsibleEE
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook": "osp.edpm.foo",
+				"healthCheck": map[string]interface{}{
+					"playbook": "osp.edpm.foo_health",
+					"retries":  0,
+				},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			healthCheckService = GetService(dataplaneServiceName).DeepCopy()
+			healthCheckService.Name = "foo-service-health-1"
+			setExecutionStatus = func(executionService *dataplanev1.OpenStackDataPlaneService, jobStatus string) *ansibleeev1.OpenStackAnsibleEE {
+				aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+					executionService, dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+				ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+				Eventually(func(g Gomega) {
+					g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+						Name:      aeeName,
+						Namespace: namespace,
+					}, ansibleEE)).To(Succeed())
+					ansibleEE.Status.JobStatus = jobStatus
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+				return ansibleEE
+			}
+		})
+
+		It("Should only mark the service ready once its health check passes", func() {
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, DefaultDataPlaneDeploymentSpec()))
+			setExecutionStatus(GetService(dataplaneServiceName), ansibleeev1.JobStatusSucceeded)
+
+			healthCheckAEE := setExecutionStatus(healthCheckService, ansibleeev1.JobStatusRunning)
+			Expect(healthCheckAEE.Spec.Playbook).Should(Equal("osp.edpm.foo_health"))
+			Consistently(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				g.Expect(nsConditions.IsTrue(deployment.GetServiceDeploymentReadyCondition("foo-service"))).To(BeFalse())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			setExecutionStatus(healthCheckService, ansibleeev1.JobStatusSucceeded)
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				g.Expect(nsConditions.IsTrue(deployment.GetServiceHealthCheckReadyCondition("foo-service"))).To(BeTrue())
+				g.Expect(nsConditions.IsTrue(deployment.GetServiceDeploymentReadyCondition("foo-service"))).To(BeTrue())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should only run the health checks of a health check only deployment", func() {
+			deploymentSpec := DefaultDataPlaneDeploymentSpec()
+			deploymentSpec["healthCheckOnly"] = true
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, deploymentSpec))
+
+			setExecutionStatus(healthCheckService, ansibleeev1.JobStatusFailed)
+			th.ExpectCondition(
+				dataplaneDeploymentName,
+				ConditionGetterFunc(DataplaneDeploymentConditionGetter),
+				condition.DeploymentReadyCondition,
+				corev1.ConditionFalse,
+			)
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				healthCondition := nsConditions.Get(deployment.GetServiceHealthCheckReadyCondition("foo-service"))
+				g.Expect(healthCondition).ToNot(BeNil())
+				g.Expect(healthCondition.Reason).To(Equal(condition.ErrorReason))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			serviceAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				GetService(dataplaneServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+				Name:      serviceAEEName,
+				Namespace: namespace,
+			}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+		})
+
+		It("Should stop a health check that timed out", func() {
+			Eventually(func(g Gomega) {
+				service := GetService(dataplaneServiceName)
+				service.Spec.HealthCheck.Timeout = 1
+				g.Expect(th.K8sClient.Update(th.Ctx, service)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			deploymentSpec := DefaultDataPlaneDeploymentSpec()
+			deploymentSpec["healthCheckOnly"] = true
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, deploymentSpec))
+
+			setExecutionStatus(healthCheckService, ansibleeev1.JobStatusRunning)
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				healthCondition := nsConditions.Get(deployment.GetServiceHealthCheckReadyCondition("foo-service"))
+				g.Expect(healthCondition).ToNot(BeNil())
+				g.Expect(healthCondition.Reason).To(Equal(condition.ErrorReason))
+				g.Expect(healthCondition.Message).To(ContainSubstring("timed out"))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			healthCheckAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				healthCheckService, dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Eventually(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+					Name:      healthCheckAEEName,
+					Namespace: namespace,
+				}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having an active deadline", func() {
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook":              "osp.edpm.foo",
+				"backoffLimit":          2,
+				"activeDeadlineSeconds": 1,
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			deploymentSpec := DefaultDataPlaneDeploymentSpec()
+			deploymentSpec["backoffLimit"] = 6
+			deploymentSpec["deploymentRequeueTime"] = 1
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, deploymentSpec))
+		})
+
+		It("Should report a timeout once an execution exceeds its deadline", func() {
+			aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				GetService(dataplaneServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			aeeNamespacedName := types.NamespacedName{
+				Name:      aeeName,
+				Namespace: namespace,
+			}
+			Eventually(func(g Gomega) {
+				ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+				g.Expect(th.K8sClient.Get(th.Ctx, aeeNamespacedName, ansibleEE)).To(Succeed())
+				g.Expect(*ansibleEE.Spec.BackoffLimit).To(Equal(int32(2)))
+				ansibleEE.Status.JobStatus = ansibleeev1.JobStatusRunning
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				deploymentCondition := GetDataplaneDeployment(dataplaneDeploymentName).Status.Conditions.Get(condition.DeploymentReadyCondition)
+				g.Expect(deploymentCondition).ToNot(BeNil())
+				g.Expect(deploymentCondition.Reason).To(Equal(dataplanev1.TimeoutReason))
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				serviceCondition := nsConditions.Get(deployment.GetServiceDeploymentReadyCondition("foo-service"))
+				g.Expect(serviceCondition).ToNot(BeNil())
+				g.Expect(serviceCondition.Reason).To(Equal(dataplanev1.TimeoutReason))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Expect(th.K8sClient.Get(th.Ctx, aeeNamespacedName, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having a hostSelector", func() {
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook": "osp.edpm.foo",
+				"hostSelector": map[string]interface{}{
+					"labels": map[string]interface{}{
+						"matchLabels": map[string]interface{}{
+							"sriov": "true",
+						},
+					},
+				},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service",
+				"hostSelector": map[string]interface{}{
+					"ansibleVars": map[string]interface{}{
+						"edpm_dpdk": "true",
+					},
+				},
+			})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			nodeSetSpec := DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)
+			node := nodeSetSpec["nodes"].(map[string]interface{})[fmt.Sprintf("%s-node-1", dataplaneNodeSetName.Name)]
+			node.(map[string]interface{})["labels"] = map[string]interface{}{
+				"sriov": "true",
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, DefaultDataPlaneDeploymentSpec()))
+		})
+
+		It("Should limit the service to the matching nodes and skip it without any", func() {
+			aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				GetService(dataplaneServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Eventually(func(g Gomega) {
+				ansibleEE := &ansibleeev1.OpenStackAnsibleEE{}
+				g.Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+					Name:      aeeName,
+					Namespace: namespace,
+				}, ansibleEE)).To(Succeed())
+				g.Expect(ansibleEE.Spec.CmdLine).To(ContainSubstring("--limit edpm-compute-node-1"))
+				ansibleEE.Status.JobStatus = ansibleeev1.JobStatusSucceeded
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, ansibleEE)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				skippedCondition := nsConditions.Get(deployment.GetServiceDeploymentReadyCondition("foo-update-service"))
+				g.Expect(skippedCondition).ToNot(BeNil())
+				g.Expect(skippedCondition.Status).To(Equal(corev1.ConditionTrue))
+				g.Expect(skippedCondition.Reason).To(Equal(dataplanev1.SkippedReason))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			skippedAEEName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				GetService(dataplaneUpdateServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+				Name:      skippedAEEName,
+				Namespace: namespace,
+			}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+		})
+	})
+
+	When("A dataplaneDeployment is created with a service having a runnerPodTemplate", func() {
+		BeforeEach(func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"playbook": "osp.edpm.foo",
+				"runnerPodTemplate": map[string]interface{}{
+					"nodeSelector": map[string]interface{}{
+						"node-role.kubernetes.io/worker": "",
+					},
+				},
+			})
+			CreateDataPlaneServiceFromSpec(dataplaneUpdateServiceName, map[string]interface{}{
+				"EDPMServiceType": "foo-service"})
+			CreateDataplaneService(dataplaneGlobalServiceName, true)
+
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			DeferCleanup(th.DeleteService, dataplaneGlobalServiceName)
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNodeSetSpec(dataplaneNodeSetName.Name)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			Eventually(func(g Gomega) {
+				// OpenStackBaremetalSet has the same name as OpenStackDataPlaneNodeSet
+				baremetal := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetal)).To(Succeed())
+				baremetal.Status.Conditions.MarkTrue(
+					condition.ReadyCondition,
+					condition.ReadyMessage)
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetal)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, CreateDataplaneDeployment(dataplaneDeploymentName, DefaultDataPlaneDeploymentSpec()))
+		})
+
+		It("Should fail the service as the runnerPodTemplate is unsupported", func() {
+			th.ExpectCondition(
+				dataplaneDeploymentName,
+				ConditionGetterFunc(DataplaneDeploymentConditionGetter),
+				condition.DeploymentReadyCondition,
+				corev1.ConditionFalse,
+			)
+			Eventually(func(g Gomega) {
+				nsConditions := GetDataplaneDeployment(dataplaneDeploymentName).Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				serviceCondition := nsConditions.Get(deployment.GetServiceDeploymentReadyCondition("foo-service"))
+				g.Expect(serviceCondition).ToNot(BeNil())
+				g.Expect(serviceCondition.Reason).To(Equal(condition.ErrorReason))
+				g.Expect(serviceCondition.Message).To(ContainSubstring("unsupported by the OpenStackAnsibleEE API"))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			aeeName, _ := dataplaneutil.GetAnsibleExecutionNameAndLabels(
+				GetService(dataplaneServiceName), dataplaneDeploymentName.Name, dataplaneNodeSetName.Name)
+			Expect(th.K8sClient.Get(th.Ctx, types.NamespacedName{
+				Name:      aeeName,
+				Namespace: namespace,
+			}, &ansibleeev1.OpenStackAnsibleEE{})).ShouldNot(Succeed())
+		})
+	})
+
 	When("A dataplaneDeployment is created with two NodeSets", func() {
 		BeforeEach(func() {
 			CreateSSHSecret(dataplaneSSHSecretName)
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"os"
 
+	metal3v1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	. "github.com/onsi/ginkgo/v2" //revive:disable:dot-imports
 	. "github.com/onsi/gomega"    //revive:disable:dot-imports
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
@@ -38,7 +39,9 @@ import (
 type AnsibleInventory struct {
 	EdpmComputeNodeset struct {
 		Vars struct {
-			AnsibleUser string `yaml:"ansible_user"`
+			AnsibleUser      string                               `yaml:"ansible_user"`
+			NodeSetTopology  map[string]NodeTopology              `yaml:"edpm_nodeset_topology"`
+			NodeSetsTopology map[string]map[string]NetworkSummary `yaml:"edpm_nodesets_topology"`
 		} `yaml:"vars"`
 		Hosts struct {
 			Node struct {
@@ -46,6 +49,12 @@ type AnsibleInventory struct {
 				AnsiblePort       string        `yaml:"ansible_port"`
 				AnsibleUser       string        `yaml:"ansible_user"`
 				CtlPlaneIP        string        `yaml:"ctlplane_ip"`
+				CtlPlaneIPv4      string        `yaml:"ctlplane_ipv4"`
+				CtlPlaneIPv6      string        `yaml:"ctlplane_ipv6"`
+				CtlPlaneIPs       []string      `yaml:"ctlplane_ips"`
+				CtlPlaneRoutes    []interface{} `yaml:"ctlplane_host_routes"`
+				CtlPlaneCidr      int           `yaml:"ctlplane_cidr"`
+				CanonicalHostname string        `yaml:"canonical_hostname"`
 				DNSSearchDomains  []interface{} `yaml:"dns_search_domains"`
 				ManagementNetwork string        `yaml:"management_network"`
 				Networks          []interface{} `yaml:"networks"`
@@ -54,6 +63,24 @@ type AnsibleInventory struct {
 	} `yaml:"edpm-compute-nodeset"`
 }
 
+// NodeTopology holds the topology of a node published in the Ansible inventory
+type NodeTopology struct {
+	HostName string `yaml:"hostname"`
+	Networks map[string]struct {
+		IP         string   `yaml:"ip"`
+		IPs        []string `yaml:"ips"`
+		HostName   string   `yaml:"hostname"`
+		DNSAliases []string `yaml:"dns_aliases"`
+	} `yaml:"networks"`
+}
+
+// NetworkSummary holds the addresses and hostnames of the nodes of a NodeSet on a network,
+// published in the Ansible inventory
+type NetworkSummary struct {
+	IPs       []string `yaml:"ips"`
+	HostNames []string `yaml:"hostnames"`
+}
+
 var _ = Describe("Dataplane NodeSet Test", func() {
 	var dataplaneNodeSetName types.NamespacedName
 	var dataplaneSecretName types.NamespacedName
@@ -230,6 +257,907 @@ var _ = Describe("Dataplane NodeSet Test", func() {
 		})
 	})
 
+	When("A Dataplane nodeset is created with a dnsMasqRef and more than one dnsmasq", func() {
+		BeforeEach(func() {
+			DeferCleanup(th.DeleteInstance,
+				CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			firstDNSMasqName := types.NamespacedName{
+				Name:      "first-dnsmasq",
+				Namespace: namespace,
+			}
+			DeferCleanup(th.DeleteInstance,
+				CreateDNSMasq(firstDNSMasqName, DefaultDNSMasqSpec()))
+			secondDNSMasqName := types.NamespacedName{
+				Name:      "second-dnsmasq",
+				Namespace: namespace,
+			}
+			secondDNSMasqSpec := DefaultDNSMasqSpec()
+			secondDNSMasqSpec["dnsDataLabelSelectorValue"] = "edge"
+			DeferCleanup(th.DeleteInstance,
+				CreateDNSMasq(secondDNSMasqName, secondDNSMasqSpec))
+			SimulateDNSMasqComplete(secondDNSMasqName)
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["dnsMasqRef"] = secondDNSMasqName.Name
+			DeferCleanup(th.DeleteInstance,
+				CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateIPSetComplete(dataplaneNodeName)
+		})
+		It("should create the DNSData for the referenced dnsmasq", func() {
+			Eventually(func(g Gomega) {
+				dnsData := &infrav1.DNSData{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, dnsData)).Should(Succeed())
+				g.Expect(dnsData.Spec.DNSDataLabelSelectorValue).Should(Equal("edge"))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A node of a Dataplane nodeset is marked as Removing", func() {
+		var removalDeploymentName types.NamespacedName
+		BeforeEach(func() {
+			removalDeploymentName = types.NamespacedName{
+				Name:      fmt.Sprintf("%s-remove-%s", dataplaneNodeSetName.Name, dataplaneNodeName.Name),
+				Namespace: namespace,
+			}
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNoNodeSetSpec(false)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.SetupReadyCondition,
+				corev1.ConditionTrue,
+			)
+		})
+
+		It("should run the removal services against the node only", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Removal = []string{"remove-compute"}
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.State = dataplanev1.NodeStateRemoving
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				removal := &dataplanev1.OpenStackDataPlaneDeployment{}
+				g.Expect(th.K8sClient.Get(th.Ctx, removalDeploymentName, removal)).Should(Succeed())
+				g.Expect(removal.Spec.ServicesOverride).Should(Equal([]string{"remove-compute"}))
+				g.Expect(removal.Spec.AnsibleLimit).Should(Equal(dataplaneNodeName.Name))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, GetDataplaneDeployment(removalDeploymentName))
+
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetNodeRemovalReadyCondition,
+				corev1.ConditionFalse,
+			)
+			Expect(GetDataplaneNodeSet(dataplaneNodeSetName).Status.RemovedNodes).Should(BeEmpty())
+			Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, &infrav1.IPSet{})).Should(Succeed())
+		})
+
+		It("should not record the removal deployment as a deployment of the NodeSet", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Removal = []string{"remove-compute"}
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.State = dataplanev1.NodeStateRemoving
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(func() {
+				Eventually(func(g Gomega) {
+					removal := &dataplanev1.OpenStackDataPlaneDeployment{}
+					g.Expect(th.K8sClient.Get(th.Ctx, removalDeploymentName, removal)).Should(Succeed())
+					th.DeleteInstance(removal)
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+
+			// The removal service doesn't exist, so the removal deployment
+			// fails
+			Eventually(func(g Gomega) {
+				removal := GetDataplaneDeployment(removalDeploymentName)
+				nsConditions := removal.Status.NodeSetConditions[dataplaneNodeSetName.Name]
+				g.Expect(condition.IsError(nsConditions.Get(dataplanev1.NodeSetDeploymentReadyCondition))).To(BeTrue())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Consistently(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(condition.IsError(instance.Status.Conditions.Get(condition.DeploymentReadyCondition))).To(BeFalse())
+				g.Expect(instance.Status.DeployedConfigHash).To(BeEmpty())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("should only have the node in the inventory of the removal deployments", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Removal = []string{"remove-compute"}
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.State = dataplanev1.NodeStateRemoving
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(func() {
+				Eventually(func(g Gomega) {
+					removal := &dataplanev1.OpenStackDataPlaneDeployment{}
+					g.Expect(th.K8sClient.Get(th.Ctx, removalDeploymentName, removal)).Should(Succeed())
+					th.DeleteInstance(removal)
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+
+			removalSecretName := types.NamespacedName{
+				Name:      fmt.Sprintf("%s-removal", dataplaneSecretName.Name),
+				Namespace: namespace,
+			}
+			Eventually(func(g Gomega) {
+				var inv AnsibleInventory
+				secret := th.GetSecret(dataplaneSecretName)
+				g.Expect(yaml.Unmarshal(secret.Data["inventory"], &inv)).Should(Succeed())
+				g.Expect(inv.EdpmComputeNodeset.Hosts.Node.AnsibleHost).Should(BeEmpty())
+
+				removalSecret := th.GetSecret(removalSecretName)
+				g.Expect(yaml.Unmarshal(removalSecret.Data["inventory"], &inv)).Should(Succeed())
+				g.Expect(inv.EdpmComputeNodeset.Hosts.Node.AnsibleHost).Should(Equal(dataplaneNodeName.Name))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("should remove the node and release its IPs without removal services", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.State = dataplanev1.NodeStateRemoving
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(instance.Status.RemovedNodes).Should(Equal([]string{dataplaneNodeName.Name}))
+				g.Expect(instance.Spec.Nodes).Should(HaveKey(dataplaneNodeName.Name))
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, &infrav1.IPSet{})).ShouldNot(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			// Setting back the state of the removed node adds it back
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.State = ""
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Eventually(func(g Gomega) {
+				g.Expect(GetDataplaneNodeSet(dataplaneNodeSetName).Status.RemovedNodes).Should(BeEmpty())
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, &infrav1.IPSet{})).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("The hardware of a node of a Dataplane nodeset is replaced", func() {
+		var replaceDeploymentName types.NamespacedName
+		BeforeEach(func() {
+			replaceDeploymentName = types.NamespacedName{
+				Name:      fmt.Sprintf("%s-replace-%s-1", dataplaneNodeSetName.Name, dataplaneNodeName.Name),
+				Namespace: namespace,
+			}
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNoNodeSetSpec(false)))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.SetupReadyCondition,
+				corev1.ConditionTrue,
+			)
+		})
+
+		It("should run the replace services against the deployed node only", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Status.DeployedConfigHash = instance.Status.ConfigHash
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			ipSet := &infrav1.IPSet{}
+			Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, ipSet)).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Replace = []string{"bootstrap", "install-os"}
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.ReplaceGeneration = 1
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				replace := &dataplanev1.OpenStackDataPlaneDeployment{}
+				g.Expect(th.K8sClient.Get(th.Ctx, replaceDeploymentName, replace)).Should(Succeed())
+				g.Expect(replace.Spec.ServicesOverride).Should(Equal([]string{"bootstrap", "install-os"}))
+				g.Expect(replace.Spec.AnsibleLimit).Should(Equal(dataplaneNodeName.Name))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, GetDataplaneDeployment(replaceDeploymentName))
+
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetNodeReplacementReadyCondition,
+				corev1.ConditionFalse,
+			)
+			instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+			Expect(instance.Status.NodeReplacements).Should(HaveKeyWithValue(dataplaneNodeName.Name,
+				dataplanev1.NodeReplacementStatus{Generation: 1, Released: true}))
+
+			// The IPs of the node are kept
+			replacedIPSet := &infrav1.IPSet{}
+			Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, replacedIPSet)).Should(Succeed())
+			Expect(replacedIPSet.UID).Should(Equal(ipSet.UID))
+		})
+
+		It("should not run the replace services against a node never deployed", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes[dataplaneNodeName.Name]
+				node.ReplaceGeneration = 1
+				instance.Spec.Nodes[dataplaneNodeName.Name] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(instance.Status.NodeReplacements).Should(HaveKeyWithValue(dataplaneNodeName.Name,
+					dataplanev1.NodeReplacementStatus{Generation: 1, Released: true, Completed: true}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Consistently(func(g Gomega) {
+				replace := &dataplanev1.OpenStackDataPlaneDeployment{}
+				g.Expect(th.K8sClient.Get(th.Ctx, replaceDeploymentName, replace)).ShouldNot(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A default service of a Dataplane nodeset is customized", func() {
+		var dataplaneDefaultServiceName types.NamespacedName
+		BeforeEach(func() {
+			dataplaneDefaultServiceName = types.NamespacedName{
+				Name:      "configure-os",
+				Namespace: namespace,
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, DefaultDataPlaneNoNodeSetSpec(false)))
+			Eventually(func(g Gomega) {
+				service := &dataplanev1.OpenStackDataPlaneService{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneDefaultServiceName, service)).Should(Succeed())
+				g.Expect(service.Status.DefaultRevision).ShouldNot(BeEmpty())
+				g.Expect(service.Annotations).Should(HaveKey(dataplanev1.ServiceLastAppliedDefaultAnnotation))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("should record the version of the catalog of default services", func() {
+			service := GetService(dataplaneDefaultServiceName)
+			Expect(service.Annotations).Should(HaveKeyWithValue(
+				dataplanev1.ServiceCatalogVersionAnnotation, serviceCatalog.Version))
+		})
+
+		It("should keep the fields changed by the user", func() {
+			Eventually(func(g Gomega) {
+				service := GetService(dataplaneDefaultServiceName)
+				service.Spec.Secrets = []string{"custom-secret"}
+				g.Expect(th.K8sClient.Update(th.Ctx, service)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			TriggerNodeSetReconcile(dataplaneNodeSetName)
+
+			Consistently(func(g Gomega) {
+				service := GetService(dataplaneDefaultServiceName)
+				g.Expect(service.Spec.Secrets).Should(Equal([]string{"custom-secret"}))
+				g.Expect(service.Spec.Playbook).Should(Equal("osp.edpm.configure_os"))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("should not change a service no longer managed by the operator", func() {
+			Eventually(func(g Gomega) {
+				service := GetService(dataplaneDefaultServiceName)
+				service.Annotations = map[string]string{dataplanev1.ServiceManagedAnnotation: "false"}
+				service.Spec.Playbook = "custom.configure_os"
+				g.Expect(th.K8sClient.Update(th.Ctx, service)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			TriggerNodeSetReconcile(dataplaneNodeSetName)
+
+			Consistently(func(g Gomega) {
+				service := GetService(dataplaneDefaultServiceName)
+				g.Expect(service.Spec.Playbook).Should(Equal("custom.configure_os"))
+				g.Expect(service.Annotations).ShouldNot(HaveKey(dataplanev1.ServiceLastAppliedDefaultAnnotation))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A nodeSet is created with an IPv4, IPv6 or dual-stack ctlplane network", func() {
+		var ipv4Reservation infrav1.IPSetReservation
+		var ipv6Reservation infrav1.IPSetReservation
+		var nodeSetSpec map[string]interface{}
+
+		getInventory := func(g Gomega) AnsibleInventory {
+			secret := &corev1.Secret{}
+			g.Expect(th.K8sClient.Get(th.Ctx, dataplaneSecretName, secret)).Should(Succeed())
+			var inv AnsibleInventory
+			g.Expect(yaml.Unmarshal(secret.Data["inventory"], &inv)).Should(Succeed())
+			return inv
+		}
+		getDNSDataIPs := func(g Gomega) []string {
+			dnsData := &infrav1.DNSData{}
+			g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, dnsData)).Should(Succeed())
+			ips := []string{}
+			for _, host := range dnsData.Spec.Hosts {
+				g.Expect(host.Hostnames).Should(ContainElement("edpm-compute-node-1.test-domain.test"))
+				ips = append(ips, host.IP)
+			}
+			return ips
+		}
+
+		BeforeEach(func() {
+			ipv4Reservation = IPv4Reservation()
+			ipv4Reservation.DNSDomain = "test-domain.test"
+			ipv6Reservation = IPv6Reservation()
+			ipv6Reservation.DNSDomain = "test-domain.test"
+			nodeSetSpec = DefaultDataPlaneNodeSetSpec("edpm-compute")
+			nodeSetSpec["preProvisioned"] = true
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			CreateSSHSecret(dataplaneSSHSecretName)
+			SimulateDNSMasqComplete(dnsMasqName)
+		})
+
+		When("The ctlplane network is IPv4 only", func() {
+			BeforeEach(func() {
+				DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+				DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+				SimulateIPSetReservations(dataplaneNodeName, []infrav1.IPSetReservation{ipv4Reservation})
+				SimulateDNSDataComplete(dataplaneNodeSetName)
+			})
+			It("Should set the IPv4 variables in the Ansible inventory secret", func() {
+				Eventually(func(g Gomega) {
+					node := getInventory(g).EdpmComputeNodeset.Hosts.Node
+					g.Expect(node.CtlPlaneIP).Should(Equal("172.20.12.76"))
+					g.Expect(node.CtlPlaneCidr).Should(Equal(16))
+					g.Expect(node.CtlPlaneIPv4).Should(Equal("172.20.12.76"))
+					g.Expect(node.CtlPlaneIPv6).Should(BeEmpty())
+					g.Expect(node.CtlPlaneIPs).Should(Equal([]string{"172.20.12.76"}))
+					g.Expect(node.CanonicalHostname).Should(Equal("edpm-compute-node-1.test-domain.test"))
+					g.Expect(node.DNSSearchDomains).Should(Equal([]interface{}{"test-domain.test"}))
+				}, th.Timeout, th.Interval).Should(Succeed())
+				Eventually(getDNSDataIPs, th.Timeout, th.Interval).Should(Equal([]string{"172.20.12.76"}))
+			})
+		})
+
+		When("The ctlplane network is IPv6 only", func() {
+			BeforeEach(func() {
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"edpm-compute-node-1": map[string]interface{}{
+						"hostName": "edpm-compute-node-1",
+						"networks": []infrav1.IPSetNetwork{
+							{Name: "ctlplane", SubnetName: "subnet2"},
+						},
+					},
+				}
+				DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, IPv6NetConfigSpec()))
+				DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+				SimulateIPSetReservations(dataplaneNodeName, []infrav1.IPSetReservation{ipv6Reservation})
+				SimulateDNSDataComplete(dataplaneNodeSetName)
+			})
+			It("Should set the IPv6 variables in the Ansible inventory secret", func() {
+				Eventually(func(g Gomega) {
+					node := getInventory(g).EdpmComputeNodeset.Hosts.Node
+					g.Expect(node.CtlPlaneIP).Should(Equal("fd00:fd00:fd00:2000::76"))
+					g.Expect(node.CtlPlaneCidr).Should(Equal(64))
+					g.Expect(node.CtlPlaneIPv4).Should(BeEmpty())
+					g.Expect(node.CtlPlaneIPv6).Should(Equal("fd00:fd00:fd00:2000::76"))
+					g.Expect(node.CtlPlaneIPs).Should(Equal([]string{"fd00:fd00:fd00:2000::76"}))
+					g.Expect(node.CanonicalHostname).Should(Equal("edpm-compute-node-1.test-domain.test"))
+				}, th.Timeout, th.Interval).Should(Succeed())
+				Eventually(getDNSDataIPs, th.Timeout, th.Interval).Should(Equal([]string{"fd00:fd00:fd00:2000::76"}))
+			})
+		})
+
+		When("The ctlplane network is dual-stack", func() {
+			BeforeEach(func() {
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"edpm-compute-node-1": map[string]interface{}{
+						"hostName": "edpm-compute-node-1",
+						"networks": []infrav1.IPSetNetwork{
+							{Name: "ctlplane", SubnetName: "subnet2"},
+							{Name: "ctlplane", SubnetName: "subnet1"},
+						},
+					},
+				}
+				DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DualStackNetConfigSpec()))
+				DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+				// The IPv6 reservation comes first, the IPv4 address must
+				// still be used for the single address variables
+				SimulateIPSetReservations(dataplaneNodeName, []infrav1.IPSetReservation{ipv6Reservation, ipv4Reservation})
+				SimulateDNSDataComplete(dataplaneNodeSetName)
+			})
+			It("Should set the variables of both families in the Ansible inventory secret", func() {
+				Eventually(func(g Gomega) {
+					node := getInventory(g).EdpmComputeNodeset.Hosts.Node
+					g.Expect(node.CtlPlaneIP).Should(Equal("172.20.12.76"))
+					g.Expect(node.CtlPlaneCidr).Should(Equal(16))
+					g.Expect(node.CtlPlaneIPv4).Should(Equal("172.20.12.76"))
+					g.Expect(node.CtlPlaneIPv6).Should(Equal("fd00:fd00:fd00:2000::76"))
+					g.Expect(node.CtlPlaneIPs).Should(Equal([]string{"fd00:fd00:fd00:2000::76", "172.20.12.76"}))
+					g.Expect(node.CanonicalHostname).Should(Equal("edpm-compute-node-1.test-domain.test"))
+					g.Expect(node.DNSSearchDomains).Should(Equal([]interface{}{"test-domain.test"}))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+			It("Should add DNS records for both families", func() {
+				Eventually(getDNSDataIPs, th.Timeout, th.Interval).Should(
+					Equal([]string{"fd00:fd00:fd00:2000::76", "172.20.12.76"}))
+				Eventually(func(g Gomega) {
+					instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+					g.Expect(instance.Status.AllIPs["edpm-compute-node-1"]).Should(
+						HaveKeyWithValue(infrav1.NetNameStr("ctlplane"), "172.20.12.76"))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+			It("Should publish the addresses of both families in the topology of the NodeSets", func() {
+				Eventually(func(g Gomega) {
+					inv := getInventory(g)
+					topology := inv.EdpmComputeNodeset.Vars.NodeSetTopology
+					g.Expect(topology).Should(HaveKey("edpm-compute-node-1"))
+					ctlplane := topology["edpm-compute-node-1"].Networks["ctlplane"]
+					g.Expect(ctlplane.IP).Should(Equal("172.20.12.76"))
+					g.Expect(ctlplane.IPs).Should(Equal([]string{"fd00:fd00:fd00:2000::76", "172.20.12.76"}))
+					nodeSetsTopology := inv.EdpmComputeNodeset.Vars.NodeSetsTopology
+					g.Expect(nodeSetsTopology).Should(HaveKey(dataplaneNodeSetName.Name))
+					g.Expect(nodeSetsTopology[dataplaneNodeSetName.Name]["ctlplane"].IPs).Should(Equal(
+						[]string{"172.20.12.76", "fd00:fd00:fd00:2000::76"}))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+
+		When("The ctlplane network is dual-stack with host routes and has vars in the ansibleVars of the node", func() {
+			BeforeEach(func() {
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"edpm-compute-node-1": map[string]interface{}{
+						"hostName": "edpm-compute-node-1",
+						"networks": []infrav1.IPSetNetwork{
+							{Name: "ctlplane", SubnetName: "subnet2"},
+							{Name: "ctlplane", SubnetName: "subnet1"},
+						},
+						"ansible": map[string]interface{}{
+							"ansibleVars": map[string]interface{}{
+								"ctlplane_ips":         []string{"192.168.0.1"},
+								"ctlplane_host_routes": "none",
+							},
+						},
+					},
+				}
+				ipv6Reservation.Routes = []infrav1.Route{
+					{Destination: "fd00:fd00:fd00:3000::/64", Nexthop: "fd00:fd00:fd00:2000::1"},
+				}
+				ipv4Reservation.Routes = []infrav1.Route{
+					{Destination: "172.21.0.0/16", Nexthop: "172.20.12.1"},
+				}
+				DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DualStackNetConfigSpec()))
+				DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+				SimulateIPSetReservations(dataplaneNodeName, []infrav1.IPSetReservation{ipv6Reservation, ipv4Reservation})
+				SimulateDNSDataComplete(dataplaneNodeSetName)
+			})
+			It("Should set the addresses and the routes of both families in the Ansible inventory secret", func() {
+				Eventually(func(g Gomega) {
+					node := getInventory(g).EdpmComputeNodeset.Hosts.Node
+					g.Expect(node.CtlPlaneIPs).Should(Equal([]string{"fd00:fd00:fd00:2000::76", "172.20.12.76"}))
+					g.Expect(node.CtlPlaneRoutes).Should(HaveLen(2))
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+	})
+
+	When("A node of a Dataplane nodeset has DNS aliases", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"edpm-compute-node-1": map[string]interface{}{
+					"hostName": "edpm-compute-node-1",
+					"dnsAliases": []map[string]interface{}{
+						{"name": "overcloud-novacompute-0"},
+						{"name": "compute-1.example.com", "network": "ctlplane"},
+					},
+				},
+			}
+			reservation := IPv4Reservation()
+			reservation.DNSDomain = "test-domain.test"
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateIPSetReservations(dataplaneNodeName, []infrav1.IPSetReservation{reservation})
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+		})
+
+		It("Should add the aliases to the DNS records and the hostnames of the node", func() {
+			Eventually(func(g Gomega) {
+				dnsData := &infrav1.DNSData{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, dnsData)).Should(Succeed())
+				g.Expect(dnsData.Spec.Hosts).Should(HaveLen(1))
+				g.Expect(dnsData.Spec.Hosts[0].Hostnames).Should(Equal([]string{
+					"edpm-compute-node-1.test-domain.test",
+					"overcloud-novacompute-0.test-domain.test",
+					"compute-1.example.com",
+				}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(instance.Status.AllHostnames["edpm-compute-node-1"]).Should(Equal(
+					map[infrav1.NetNameStr]string{
+						"ctlplane": "edpm-compute-node-1.test-domain.test",
+					}))
+				g.Expect(instance.Status.DNSAliases["edpm-compute-node-1"]).Should(Equal(
+					map[infrav1.NetNameStr][]string{
+						"ctlplane": {
+							"compute-1.example.com",
+							"overcloud-novacompute-0.test-domain.test",
+						},
+					}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should publish the hostnames and IPs of the nodes in the Ansible inventory", func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			Eventually(func(g Gomega) {
+				secret := &corev1.Secret{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneSecretName, secret)).Should(Succeed())
+				var inv AnsibleInventory
+				g.Expect(yaml.Unmarshal(secret.Data["inventory"], &inv)).Should(Succeed())
+				topology := inv.EdpmComputeNodeset.Vars.NodeSetTopology
+				g.Expect(topology).Should(HaveKey("edpm-compute-node-1"))
+				node := topology["edpm-compute-node-1"]
+				g.Expect(node.HostName).Should(Equal("edpm-compute-node-1"))
+				g.Expect(node.Networks).Should(HaveKey("ctlplane"))
+				g.Expect(node.Networks["ctlplane"].IP).Should(Equal("172.20.12.76"))
+				g.Expect(node.Networks["ctlplane"].HostName).Should(Equal("edpm-compute-node-1.test-domain.test"))
+				g.Expect(node.Networks["ctlplane"].DNSAliases).Should(Equal([]string{
+					"compute-1.example.com",
+					"overcloud-novacompute-0.test-domain.test",
+				}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should publish the addresses of the nodes of the other NodeSets in the Ansible inventory", func() {
+			CreateSSHSecret(dataplaneSSHSecretName)
+			networkerNodeSetName := types.NamespacedName{
+				Name:      "edpm-networker-nodeset",
+				Namespace: namespace,
+			}
+			networkerNodeName := types.NamespacedName{
+				Name:      "edpm-networker-node-1",
+				Namespace: namespace,
+			}
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				networkerNodeName.Name: map[string]interface{}{
+					"hostName": networkerNodeName.Name,
+				},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(networkerNodeSetName, nodeSetSpec))
+			reservation := IPv4Reservation()
+			reservation.Address = "172.20.12.77"
+			reservation.DNSDomain = "test-domain.test"
+			SimulateIPSetReservations(networkerNodeName, []infrav1.IPSetReservation{reservation})
+			SimulateDNSDataComplete(networkerNodeSetName)
+
+			Eventually(func(g Gomega) {
+				secret := &corev1.Secret{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneSecretName, secret)).Should(Succeed())
+				var inv AnsibleInventory
+				g.Expect(yaml.Unmarshal(secret.Data["inventory"], &inv)).Should(Succeed())
+				topology := inv.EdpmComputeNodeset.Vars.NodeSetsTopology
+				g.Expect(topology).Should(HaveKey(dataplaneNodeSetName.Name))
+				g.Expect(topology[dataplaneNodeSetName.Name]["ctlplane"].IPs).Should(Equal([]string{"172.20.12.76"}))
+				g.Expect(topology).Should(HaveKey(networkerNodeSetName.Name))
+				g.Expect(topology[networkerNodeSetName.Name]["ctlplane"]).Should(Equal(NetworkSummary{
+					IPs:       []string{"172.20.12.77"},
+					HostNames: []string{"edpm-networker-node-1.test-domain.test"},
+				}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A baremetal nodeset has a node without a ctlplane network", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["preProvisioned"] = false
+			nodeSetSpec["nodeTemplate"] = map[string]interface{}{
+				"ansibleSSHPrivateKeySecret": "dataplane-ansible-ssh-private-key-secret",
+			}
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"edpm-compute-node-1": map[string]interface{}{
+					"hostName": "edpm-compute-node-1",
+				},
+			}
+			nodeSetSpec["baremetalSetTemplate"] = map[string]interface{}{
+				"deploymentSSHSecret": "dataplane-ansible-ssh-private-key-secret",
+				"ctlplaneInterface":   "eth0",
+				"ctlplaneGateway":     "192.168.122.1",
+				"bootstrapDns":        []string{"192.168.122.80"},
+			}
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			CreateSSHSecret(dataplaneSSHSecretName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+		})
+
+		It("Should not provision the node without a ctlPlaneIP", func() {
+			th.ExpectConditionWithDetails(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+				corev1.ConditionFalse,
+				condition.ErrorReason,
+				fmt.Sprintf(dataplanev1.NodeSetBaremetalProvisionCtlPlaneIPErrorMessage, "edpm-compute-node-1"),
+			)
+			Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, &baremetalv1.OpenStackBaremetalSet{})).ShouldNot(Succeed())
+		})
+
+		It("Should provision the node with its ctlPlaneIP", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["edpm-compute-node-1"]
+				node.CtlPlaneIP = "192.168.122.100/24"
+				instance.Spec.Nodes["edpm-compute-node-1"] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				baremetalSet := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetalSet)).Should(Succeed())
+				g.Expect(baremetalSet.Spec.BaremetalHosts["edpm-compute-node-1"].CtlPlaneIP).Should(Equal("192.168.122.100/24"))
+				g.Expect(baremetalSet.Spec.CtlplaneGateway).Should(Equal("192.168.122.1"))
+				g.Expect(baremetalSet.Spec.BootstrapDNS).Should(Equal([]string{"192.168.122.80"}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should report the provisioning progress of the node", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["edpm-compute-node-1"]
+				node.CtlPlaneIP = "192.168.122.100/24"
+				instance.Spec.Nodes["edpm-compute-node-1"] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				baremetalSet := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetalSet)).Should(Succeed())
+				baremetalSet.Status.BaremetalHosts = map[string]baremetalv1.HostStatus{
+					"edpm-compute-node-1": {
+						IPStatus: baremetalv1.IPStatus{
+							Hostname: "edpm-compute-node-1",
+							BmhRef:   "compute-bmh-1",
+						},
+						ProvisioningState: "provisioning",
+					},
+				}
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetalSet)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			th.ExpectConditionWithDetails(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+				corev1.ConditionFalse,
+				condition.RequestedReason,
+				fmt.Sprintf(dataplanev1.NodeSetBaremetalProvisionReadyHostsWaitingMessage,
+					0, 1, "edpm-compute-node-1 (provisioning)"),
+			)
+			Expect(GetDataplaneNodeSet(dataplaneNodeSetName).Status.BaremetalHosts).Should(Equal(
+				map[string]dataplanev1.BaremetalHostStatus{
+					"edpm-compute-node-1": {
+						BmhRef:            "compute-bmh-1",
+						ProvisioningState: "provisioning",
+					},
+				}))
+		})
+
+		It("Should report the error of the BaremetalHost of the node", func() {
+			bmhName := types.NamespacedName{
+				Name:      fmt.Sprintf("%s-bmh", namespace),
+				Namespace: BaremetalHostNamespace,
+			}
+			bmh := CreateBaremetalHost(bmhName, nil, nil)
+			Eventually(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, bmhName, bmh)).Should(Succeed())
+				bmh.Status.Provisioning.State = metal3v1.StateInspecting
+				bmh.Status.ErrorType = metal3v1.InspectionError
+				bmh.Status.ErrorMessage = "unable to start inspection"
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, bmh)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["edpm-compute-node-1"]
+				node.CtlPlaneIP = "192.168.122.100/24"
+				instance.Spec.Nodes["edpm-compute-node-1"] = node
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				baremetalSet := &baremetalv1.OpenStackBaremetalSet{}
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, baremetalSet)).Should(Succeed())
+				baremetalSet.Status.BaremetalHosts = map[string]baremetalv1.HostStatus{
+					"edpm-compute-node-1": {
+						IPStatus: baremetalv1.IPStatus{
+							Hostname: "edpm-compute-node-1",
+							BmhRef:   bmhName.Name,
+						},
+						ProvisioningState: "inspecting",
+					},
+				}
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, baremetalSet)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+
+			th.ExpectConditionWithDetails(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetBareMetalProvisionReadyCondition,
+				corev1.ConditionFalse,
+				condition.RequestedReason,
+				fmt.Sprintf(dataplanev1.NodeSetBaremetalProvisionReadyHostsWaitingMessage,
+					0, 1, "edpm-compute-node-1 (inspecting: unable to start inspection)"),
+			)
+			Expect(GetDataplaneNodeSet(dataplaneNodeSetName).Status.BaremetalHosts).Should(Equal(
+				map[string]dataplanev1.BaremetalHostStatus{
+					"edpm-compute-node-1": {
+						BmhRef:            bmhName.Name,
+						ProvisioningState: "inspecting",
+						ErrorMessage:      "unable to start inspection",
+					},
+				}))
+		})
+	})
+
+	When("A baremetal nodeset has more nodes than available BaremetalHosts", func() {
+		var bmhLabels map[string]string
+		BeforeEach(func() {
+			bmhLabels = map[string]string{"pool": namespace}
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["preProvisioned"] = false
+			nodeSetSpec["nodeTemplate"] = map[string]interface{}{
+				"ansibleSSHPrivateKeySecret": "dataplane-ansible-ssh-private-key-secret",
+			}
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"edpm-compute-node-1": map[string]interface{}{
+					"hostName":   "edpm-compute-node-1",
+					"ctlPlaneIP": "192.168.122.100/24",
+				},
+			}
+			nodeSetSpec["baremetalSetTemplate"] = map[string]interface{}{
+				"deploymentSSHSecret": "dataplane-ansible-ssh-private-key-secret",
+				"ctlplaneInterface":   "eth0",
+				"ctlplaneGateway":     "192.168.122.1",
+				"bootstrapDns":        []string{"192.168.122.80"},
+				"bmhLabelSelector":    bmhLabels,
+			}
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			CreateSSHSecret(dataplaneSSHSecretName)
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+		})
+
+		It("Should report the missing BaremetalHosts and not provision the nodes", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				provisionReady := instance.Status.Conditions.Get(dataplanev1.NodeSetBareMetalProvisionReadyCondition)
+				g.Expect(provisionReady).ShouldNot(BeNil())
+				g.Expect(provisionReady.Status).Should(Equal(corev1.ConditionFalse))
+				g.Expect(provisionReady.Reason).Should(Equal(dataplanev1.InsufficientBaremetalHostsReason))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, &baremetalv1.OpenStackBaremetalSet{})).ShouldNot(Succeed())
+		})
+
+		It("Should provision the nodes once a BaremetalHost is available", func() {
+			CreateBaremetalHost(types.NamespacedName{
+				Name:      fmt.Sprintf("%s-bmh", namespace),
+				Namespace: BaremetalHostNamespace,
+			}, bmhLabels, nil)
+
+			Eventually(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, &baremetalv1.OpenStackBaremetalSet{})).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("Should count the BaremetalHosts already consumed by the BaremetalSet as available", func() {
+			CreateBaremetalHost(types.NamespacedName{
+				Name:      fmt.Sprintf("%s-bmh", namespace),
+				Namespace: BaremetalHostNamespace,
+			}, bmhLabels, &corev1.ObjectReference{
+				APIVersion: baremetalv1.GroupVersion.String(),
+				Kind:       "OpenStackBaremetalSet",
+				Name:       dataplaneNodeSetName.Name,
+				Namespace:  dataplaneNodeSetName.Namespace,
+			})
+
+			Eventually(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, &baremetalv1.OpenStackBaremetalSet{})).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
+	When("A Dataplane nodeset with teardown services is deleted", func() {
+		var teardownDeploymentName types.NamespacedName
+		BeforeEach(func() {
+			teardownDeploymentName = types.NamespacedName{
+				Name:      fmt.Sprintf("%s-teardown", dataplaneNodeSetName.Name),
+				Namespace: namespace,
+			}
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+			DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+			SimulateDNSMasqComplete(dnsMasqName)
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["teardown"] = []string{"teardown-compute"}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			SimulateIPSetComplete(dataplaneNodeName)
+			SimulateDNSDataComplete(dataplaneNodeSetName)
+		})
+
+		It("should have a finalizer", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(instance.Finalizers).Should(ContainElement("OpenStackDataPlaneNodeSet"))
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+
+		It("should release the IPs and DNS records of nodes never deployed", func() {
+			th.DeleteInstance(GetDataplaneNodeSet(dataplaneNodeSetName))
+			Eventually(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, &infrav1.IPSet{})).ShouldNot(Succeed())
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeSetName, &infrav1.DNSData{})).ShouldNot(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Expect(th.K8sClient.Get(th.Ctx, teardownDeploymentName,
+				&dataplanev1.OpenStackDataPlaneDeployment{})).ShouldNot(Succeed())
+		})
+
+		It("should run the teardown services of deployed nodes before releasing their IPs", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				g.Expect(instance.Finalizers).ShouldNot(BeEmpty())
+				instance.Status.DeployedConfigHash = instance.Status.ConfigHash
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Expect(th.K8sClient.Delete(th.Ctx, GetDataplaneNodeSet(dataplaneNodeSetName))).Should(Succeed())
+
+			Eventually(func(g Gomega) {
+				teardown := &dataplanev1.OpenStackDataPlaneDeployment{}
+				g.Expect(th.K8sClient.Get(th.Ctx, teardownDeploymentName, teardown)).Should(Succeed())
+				g.Expect(teardown.Spec.NodeSets).Should(Equal([]string{dataplaneNodeSetName.Name}))
+				g.Expect(teardown.Spec.ServicesOverride).Should(Equal([]string{"teardown-compute"}))
+			}, th.Timeout, th.Interval).Should(Succeed())
+			DeferCleanup(th.DeleteInstance, GetDataplaneDeployment(teardownDeploymentName))
+
+			th.ExpectCondition(
+				dataplaneNodeSetName,
+				ConditionGetterFunc(DataplaneConditionGetter),
+				dataplanev1.NodeSetTeardownReadyCondition,
+				corev1.ConditionFalse,
+			)
+			Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, &infrav1.IPSet{})).Should(Succeed())
+
+			// Clearing the teardown services skips the teardown
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Teardown = nil
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Eventually(func(g Gomega) {
+				g.Expect(th.K8sClient.Get(th.Ctx, dataplaneNodeName, &infrav1.IPSet{})).ShouldNot(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+		})
+	})
+
 	When("TLS is enabled", func() {
 		tlsEnabled := true
 		When("A Dataplane resource is created with PreProvisioned nodes, no deployment", func() {
@@ -352,6 +1280,34 @@ var _ = Describe("Dataplane NodeSet Test", func() {
 			})
 		})
 
+		When("A Dataplane resource deployed before its TLS state was recorded", func() {
+			BeforeEach(func() {
+				DeferCleanup(th.DeleteInstance, CreateNetConfig(dataplaneNetConfigName, DefaultNetConfigSpec()))
+				DeferCleanup(th.DeleteInstance, CreateDNSMasq(dnsMasqName, DefaultDNSMasqSpec()))
+				SimulateDNSMasqComplete(dnsMasqName)
+				DeferCleanup(th.DeleteInstance,
+					CreateDataplaneNodeSet(dataplaneNodeSetName,
+						DefaultDataPlaneNoNodeSetSpec(tlsEnabled)))
+				// NodeSets deployed before DeployedTLSEnabled was recorded only
+				// have a DeployedConfigHash
+				Eventually(func(g Gomega) {
+					instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+					instance.Status.DeployedConfigHash = "deployed"
+					g.Expect(th.K8sClient.Status().Update(th.Ctx, instance)).To(Succeed())
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+
+			It("Should record the current TLS state and not start a TLS transition", func() {
+				Eventually(func(g Gomega) {
+					instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+					g.Expect(instance.Status.DeployedTLSEnabled).ToNot(BeNil())
+					g.Expect(*instance.Status.DeployedTLSEnabled).To(BeTrue())
+					g.Expect(instance.IsTLSTransitionPending()).To(BeFalse())
+					g.Expect(instance.Status.Conditions.Has(dataplanev1.NodeSetTLSTransitionCondition)).To(BeFalse())
+				}, th.Timeout, th.Interval).Should(Succeed())
+			})
+		})
+
 		When("A Dataplane resource is created with PreProvisioned nodes, no deployment and global service", func() {
 			BeforeEach(func() {
 				nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(tlsEnabled)
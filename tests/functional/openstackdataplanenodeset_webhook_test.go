@@ -8,14 +8,27 @@ import (
 	. "github.com/onsi/gomega"    //revive:disable:dot-imports
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	v1beta1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
+	infrav1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	"github.com/openstack-k8s-operators/lib-common/modules/common/condition"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
 )
 
+// warningRecorder records the warnings returned by the API server
+type warningRecorder struct {
+	warnings []string
+}
+
+func (w *warningRecorder) HandleWarningHeader(_ int, _ string, text string) {
+	w.warnings = append(w.warnings, text)
+}
+
 var _ = Describe("DataplaneNodeSet Webhook", func() {
 
 	var dataplaneNodeSetName types.NamespacedName
@@ -132,6 +145,132 @@ var _ = Describe("DataplaneNodeSet Webhook", func() {
 
 	})
 
+	When("A baremetal NodeSet has a pre-provisioned node", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["preProvisioned"] = false
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"compute-0": map[string]interface{}{
+					"hostName": "compute-0"},
+				"compute-1": map[string]interface{}{
+					"hostName":       "compute-1",
+					"preProvisioned": true},
+			}
+			nodeSetSpec["baremetalSetTemplate"] = baremetalv1.OpenStackBaremetalSetSpec{
+				DomainName:    "example.com",
+				CloudUserName: "cloud-bm",
+				BmhLabelSelector: map[string]string{
+					"app": "test-openstack",
+				},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+		})
+
+		It("Should only provision the baremetal node", func() {
+			instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+			Expect(instance.Spec.Nodes["compute-0"].HostName).Should(Equal("compute-0.example.com"))
+			Expect(instance.Spec.Nodes["compute-1"].HostName).Should(Equal("compute-1"))
+			Expect(instance.Spec.BaremetalSetTemplate.BaremetalHosts).Should(HaveLen(1))
+			Expect(instance.Spec.BaremetalSetTemplate.BaremetalHosts).Should(HaveKey("compute-0.example.com"))
+		})
+
+		It("Should only set the cloud user on the baremetal node", func() {
+			instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+			Expect(instance.Spec.Nodes["compute-0"].Ansible.AnsibleUser).Should(Equal("cloud-bm"))
+			Expect(instance.Spec.Nodes["compute-1"].Ansible.AnsibleUser).Should(BeEmpty())
+			Expect(instance.Spec.NodeTemplate.Ansible.AnsibleUser).Should(Equal("cloud-admin"))
+		})
+
+		It("Should block changing the preProvisioned of a node", func() {
+			Eventually(func(_ Gomega) string {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["compute-1"]
+				preProvisioned := false
+				node.PreProvisioned = &preProvisioned
+				instance.Spec.Nodes["compute-1"] = node
+				err := th.K8sClient.Update(th.Ctx, instance)
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("preProvisioned of an existing node can't be changed"))
+		})
+	})
+
+	When("A baremetal node has baremetal overrides", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["preProvisioned"] = false
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"compute-0": map[string]interface{}{
+					"hostName": "compute-0",
+					"userData": map[string]interface{}{
+						"name": "node-user-data",
+					},
+					"networkData": map[string]interface{}{
+						"name": "node-network-data",
+					},
+					"baremetal": map[string]interface{}{
+						"userData": map[string]interface{}{
+							"name": "baremetal-user-data",
+						},
+						"preprovisioningNetworkDataName": "baremetal-preprovisioning-network-data",
+					},
+				},
+			}
+			nodeSetSpec["baremetalSetTemplate"] = baremetalv1.OpenStackBaremetalSetSpec{
+				CloudUserName: "cloud-bm",
+				BmhLabelSelector: map[string]string{
+					"app": "test-openstack",
+				},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+		})
+
+		It("Should merge the overrides into the baremetal host of the node", func() {
+			instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+			host := instance.Spec.BaremetalSetTemplate.BaremetalHosts["compute-0"]
+			Expect(host.UserData.Name).Should(Equal("baremetal-user-data"))
+			Expect(host.NetworkData.Name).Should(Equal("node-network-data"))
+			Expect(host.PreprovisioningNetworkDataName).Should(Equal("baremetal-preprovisioning-network-data"))
+		})
+
+		It("Should block changing the overrides of an existing node", func() {
+			Eventually(func(_ Gomega) string {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["compute-0"]
+				node.Baremetal.PreprovisioningNetworkDataName = "other-preprovisioning-network-data"
+				instance.Spec.Nodes["compute-0"] = node
+				err := th.K8sClient.Update(th.Ctx, instance)
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("baremetal of an existing node can only be changed along with an increment of its replaceGeneration"))
+		})
+
+		It("Should allow changing the overrides along with a replacement of the node", func() {
+			Eventually(func(_ Gomega) error {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["compute-0"]
+				node.Baremetal.PreprovisioningNetworkDataName = "other-preprovisioning-network-data"
+				node.ReplaceGeneration = 1
+				instance.Spec.Nodes["compute-0"] = node
+				return th.K8sClient.Update(th.Ctx, instance)
+			}).Should(Succeed())
+		})
+
+		It("Should block overrides on a pre-provisioned node", func() {
+			Eventually(func(_ Gomega) string {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				preProvisioned := true
+				instance.Spec.Nodes["compute-1"] = v1beta1.NodeSection{
+					HostName:       "compute-1",
+					PreProvisioned: &preProvisioned,
+					Baremetal: &v1beta1.BaremetalOverrides{
+						PreprovisioningNetworkDataName: "compute-1-preprovisioning-network-data",
+					},
+				}
+				err := th.K8sClient.Update(th.Ctx, instance)
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("baremetal can't be set on the pre-provisioned node compute-1"))
+		})
+	})
+
 	When("A user tries to redeclare an existing node in a new NodeSet", func() {
 		BeforeEach(func() {
 			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
@@ -188,6 +327,266 @@ var _ = Describe("DataplaneNodeSet Webhook", func() {
 			}).Should(ContainSubstring("already exists in another cluster"))
 		})
 	})
+	When("A user declares conflicting nodes in a baremetal NodeSet", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["preProvisioned"] = false
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"compute-0": map[string]interface{}{
+					"hostName": "compute-0",
+					"networks": []map[string]interface{}{{
+						"name":       "CtlPlane",
+						"subnetName": "subnet1",
+						"fixedIP":    "172.20.12.10",
+					}},
+				},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+		})
+
+		It("Should block a duplicate hostName in another NodeSet", func() {
+			Eventually(func(_ Gomega) string {
+				newNodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				newNodeSetSpec["preProvisioned"] = false
+				newNodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-1": map[string]interface{}{
+						"hostName": "compute-0"},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(types.NamespacedName{Name: "test-duplicate-hostname", Namespace: namespace}, newNodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("already exists in another cluster"))
+		})
+
+		It("Should block a fixedIP already used on the network", func() {
+			Eventually(func(_ Gomega) string {
+				newNodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				newNodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-1": map[string]interface{}{
+						"hostName": "compute-1",
+						"networks": []map[string]interface{}{{
+							"name":       "ctlplane",
+							"subnetName": "subnet1",
+							"fixedIP":    "172.20.12.10",
+						}},
+					},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(types.NamespacedName{Name: "test-duplicate-fixedip", Namespace: namespace}, newNodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("is already used by node compute-0"))
+		})
+
+		It("Should block a conflicting fixedIP on update", func() {
+			Eventually(func(_ Gomega) string {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Nodes["compute-1"] = v1beta1.NodeSection{
+					HostName: "compute-1",
+					Networks: instance.Spec.Nodes["compute-0"].Networks,
+				}
+				err := th.K8sClient.Update(th.Ctx, instance)
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("is already used by node compute-0"))
+		})
+	})
+
+	When("A NetConfig exists", func() {
+		BeforeEach(func() {
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(types.NamespacedName{
+				Name: "dataplane-netconfig", Namespace: namespace}, DefaultNetConfigSpec()))
+		})
+
+		It("Should block a fixedIP outside of its subnet", func() {
+			Eventually(func(_ Gomega) string {
+				nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-0": map[string]interface{}{
+						"hostName": "compute-0",
+						"networks": []map[string]interface{}{{
+							"name":       "ctlplane",
+							"subnetName": "subnet1",
+							"fixedIP":    "192.168.122.100",
+						}},
+					},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(dataplaneNodeSetName, nodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("is outside of the 172.20.12.0/16 CIDR"))
+		})
+	})
+
+	When("A NetConfig is created after a NodeSet with fixed IPs", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"compute-0": map[string]interface{}{
+					"hostName": "compute-0",
+					"networks": []map[string]interface{}{{
+						"name":       "ctlplane",
+						"subnetName": "subnet1",
+						"fixedIP":    "192.168.122.100",
+					}},
+				},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+			DeferCleanup(th.DeleteInstance, CreateNetConfig(types.NamespacedName{
+				Name: "dataplane-netconfig", Namespace: namespace}, DefaultNetConfigSpec()))
+		})
+
+		It("Should allow updates not changing the existing nodes", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Tags = []string{"compute"}
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).Should(Succeed())
+			}).Should(Succeed())
+		})
+
+		It("Should block a new node with a fixedIP outside of its subnet", func() {
+			fixedIP := "192.168.122.101"
+			Eventually(func(_ Gomega) string {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.Nodes["compute-1"] = v1beta1.NodeSection{
+					HostName: "compute-1",
+					Networks: []infrav1.IPSetNetwork{{
+						Name:       "ctlplane",
+						SubnetName: "subnet1",
+						FixedIP:    &fixedIP,
+					}},
+				}
+				err := th.K8sClient.Update(th.Ctx, instance)
+				return fmt.Sprintf("%s", err)
+			}).Should(And(
+				ContainSubstring("fixedIP 192.168.122.101 of node compute-1 is outside of the 172.20.12.0/16 CIDR"),
+				Not(ContainSubstring("compute-0"))))
+		})
+	})
+
+	When("A user declares DNS aliases for the nodes", func() {
+		It("Should block an alias on a network of another node", func() {
+			Eventually(func(_ Gomega) string {
+				nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-0": map[string]interface{}{
+						"hostName": "compute-0",
+						"dnsAliases": []map[string]interface{}{{
+							"name":    "compute-0-storage",
+							"network": "storage",
+						}},
+					},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(dataplaneNodeSetName, nodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("node compute-0 has no address on network storage"))
+		})
+
+		It("Should block an alias already used on the network", func() {
+			Eventually(func(_ Gomega) string {
+				nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-0": map[string]interface{}{
+						"hostName":   "compute-0",
+						"dnsAliases": []map[string]interface{}{{"name": "overcloud-compute-0"}},
+					},
+					"compute-1": map[string]interface{}{
+						"hostName":   "compute-1",
+						"dnsAliases": []map[string]interface{}{{"name": "overcloud-compute-0"}},
+					},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(dataplaneNodeSetName, nodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("DNS alias overcloud-compute-0 on network ctlplane is already used by node compute-0"))
+		})
+	})
+
+	When("A user declares explicit ctlplane addresses for baremetal nodes", func() {
+		It("Should block a ctlPlaneIP which is not in CIDR notation", func() {
+			Eventually(func(_ Gomega) string {
+				nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				nodeSetSpec["preProvisioned"] = false
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-0": map[string]interface{}{
+						"hostName":   "compute-0",
+						"ctlPlaneIP": "192.168.122.100",
+					},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(dataplaneNodeSetName, nodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("ctlPlaneIP is not an IP address in CIDR notation"))
+		})
+
+		It("Should block a ctlplaneGateway outside of the ctlPlaneIP of a node", func() {
+			Eventually(func(_ Gomega) string {
+				nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+				nodeSetSpec["preProvisioned"] = false
+				nodeSetSpec["baremetalSetTemplate"] = map[string]interface{}{
+					"ctlplaneInterface": "eth0",
+					"ctlplaneGateway":   "192.168.24.1",
+				}
+				nodeSetSpec["nodes"] = map[string]interface{}{
+					"compute-0": map[string]interface{}{
+						"hostName":   "compute-0",
+						"ctlPlaneIP": "192.168.122.100/24",
+					},
+				}
+				newInstance := DefaultDataplaneNodeSetTemplate(dataplaneNodeSetName, nodeSetSpec)
+				unstructuredObj := &unstructured.Unstructured{Object: newInstance}
+				_, err := controllerutil.CreateOrPatch(
+					th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("ctlplaneGateway 192.168.24.1 is outside of the ctlPlaneIP 192.168.122.100/24 of node compute-0"))
+		})
+	})
+
+	When("A user replaces the hardware of a node", func() {
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"compute-0": map[string]interface{}{
+					"hostName":          "compute-0",
+					"replaceGeneration": 2,
+				},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+		})
+
+		It("Should allow incrementing the replaceGeneration", func() {
+			Eventually(func(_ Gomega) error {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["compute-0"]
+				node.ReplaceGeneration = 3
+				instance.Spec.Nodes["compute-0"] = node
+				return th.K8sClient.Update(th.Ctx, instance)
+			}).Should(Succeed())
+		})
+
+		It("Should block decreasing the replaceGeneration", func() {
+			Eventually(func(_ Gomega) string {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				node := instance.Spec.Nodes["compute-0"]
+				node.ReplaceGeneration = 1
+				instance.Spec.Nodes["compute-0"] = node
+				err := th.K8sClient.Update(th.Ctx, instance)
+				return fmt.Sprintf("%s", err)
+			}).Should(ContainSubstring("replaceGeneration can't be decreased from 2"))
+		})
+	})
+
 	When("A NodeSet is updated with a OpenStackDataPlaneDeployment", func() {
 		BeforeEach(func() {
 			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
@@ -242,5 +641,72 @@ var _ = Describe("DataplaneNodeSet Webhook", func() {
 			}).Should(ContainSubstring(fmt.Sprintf("could not patch openstackdataplanenodeset while openstackdataplanedeployment %s (blocked on %s condition) is running",
 				dataplaneDeploymentName.Name, string(v1beta1.NodeSetDeploymentReadyCondition))))
 		})
+		It("Should allow metadata updates if Deployment is NOT completed", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+
+				deploymentReadyConditions := condition.Conditions{}
+				deploymentReadyConditions.MarkFalse(
+					v1beta1.NodeSetDeploymentReadyCondition,
+					"mock-error",
+					condition.SeverityWarning,
+					condition.ReadyMessage)
+
+				instance.Status.DeploymentStatuses = make(map[string]condition.Conditions)
+				instance.Status.DeploymentStatuses[dataplaneDeploymentName.Name] = deploymentReadyConditions
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, instance)).To(Succeed())
+
+				instance.Labels = map[string]string{"foo": "bar"}
+				g.Expect(th.K8sClient.Update(th.Ctx, instance)).To(Succeed())
+			}).Should(Succeed())
+		})
+	})
+
+	When("A user enables TLS on a NodeSet", func() {
+		var recorder *warningRecorder
+		var recordingClient client.Client
+
+		BeforeEach(func() {
+			nodeSetSpec := DefaultDataPlaneNoNodeSetSpec(false)
+			nodeSetSpec["nodes"] = map[string]interface{}{
+				"compute-0": map[string]interface{}{
+					"hostName": "compute-0"},
+			}
+			DeferCleanup(th.DeleteInstance, CreateDataplaneNodeSet(dataplaneNodeSetName, nodeSetSpec))
+
+			recorder = &warningRecorder{}
+			cfg := rest.CopyConfig(testEnv.Config)
+			cfg.WarningHandler = recorder
+			var err error
+			recordingClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		It("Should warn about the TLS transition of an already deployed NodeSet", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				tlsEnabled := false
+				instance.Status.DeployedConfigHash = "deployed"
+				instance.Status.DeployedTLSEnabled = &tlsEnabled
+				g.Expect(th.K8sClient.Status().Update(th.Ctx, instance)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.TLSEnabled = true
+				g.Expect(recordingClient.Update(th.Ctx, instance)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Expect(recorder.warnings).Should(ContainElement(ContainSubstring(
+				"TLS has been enabled on the already deployed OpenStackDataPlaneNodeSet")))
+		})
+
+		It("Should not warn about a NodeSet which is not deployed", func() {
+			Eventually(func(g Gomega) {
+				instance := GetDataplaneNodeSet(dataplaneNodeSetName)
+				instance.Spec.TLSEnabled = true
+				g.Expect(recordingClient.Update(th.Ctx, instance)).To(Succeed())
+			}, th.Timeout, th.Interval).Should(Succeed())
+			Expect(recorder.warnings).ShouldNot(ContainElement(ContainSubstring(
+				"TLS has been enabled")))
+		})
 	})
 })
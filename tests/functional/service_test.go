@@ -16,11 +16,14 @@ limitations under the License.
 package functional
 
 import (
+	"fmt"
 	"os"
 
 	. "github.com/onsi/ginkgo/v2" //revive:disable:dot-imports
 	. "github.com/onsi/gomega"    //revive:disable:dot-imports
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 var _ = Describe("OpenstackDataplaneService Test", func() {
@@ -63,4 +66,110 @@ var _ = Describe("OpenstackDataplaneService Test", func() {
 			Expect(service.Spec.DeployOnAllNodeSets).To(BeTrue())
 		})
 	})
+
+	When("A service has sources of CA certs", func() {
+		It("Should block a source without a Secret, ConfigMap or cluster bundle", func() {
+			raw := map[string]interface{}{
+				"apiVersion": "dataplane.openstack.org/v1beta1",
+				"kind":       "OpenStackDataPlaneService",
+				"metadata": map[string]interface{}{
+					"name":      dataplaneServiceName.Name,
+					"namespace": dataplaneServiceName.Namespace,
+				},
+				"spec": map[string]interface{}{
+					"caCertsFrom": []map[string]interface{}{
+						{"keys": []string{"ca.crt"}},
+					},
+				},
+			}
+			unstructuredObj := &unstructured.Unstructured{Object: raw}
+			_, err := controllerutil.CreateOrPatch(
+				th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+			Expect(fmt.Sprintf("%s", err)).Should(ContainSubstring(
+				"exactly one of secretRef, configMapRef and clusterTrustedBundle must be set"))
+		})
+
+		It("Should block a source with both a Secret and a ConfigMap", func() {
+			raw := map[string]interface{}{
+				"apiVersion": "dataplane.openstack.org/v1beta1",
+				"kind":       "OpenStackDataPlaneService",
+				"metadata": map[string]interface{}{
+					"name":      dataplaneServiceName.Name,
+					"namespace": dataplaneServiceName.Namespace,
+				},
+				"spec": map[string]interface{}{
+					"caCertsFrom": []map[string]interface{}{
+						{
+							"secretRef":    map[string]interface{}{"name": "ca-secret"},
+							"configMapRef": map[string]interface{}{"name": "ca-configmap"},
+						},
+					},
+				},
+			}
+			unstructuredObj := &unstructured.Unstructured{Object: raw}
+			_, err := controllerutil.CreateOrPatch(
+				th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+			Expect(fmt.Sprintf("%s", err)).Should(ContainSubstring(
+				"exactly one of secretRef, configMapRef and clusterTrustedBundle must be set"))
+		})
+
+		It("Should allow a source with only a Secret", func() {
+			CreateDataPlaneServiceFromSpec(dataplaneServiceName, map[string]interface{}{
+				"caCertsFrom": []map[string]interface{}{
+					{"secretRef": map[string]interface{}{"name": "ca-secret"}},
+				},
+			})
+			DeferCleanup(th.DeleteService, dataplaneServiceName)
+			service := GetService(dataplaneServiceName)
+			Expect(service.Spec.CACertsFrom).To(HaveLen(1))
+		})
+	})
+
+	When("A service has hooks", func() {
+		It("Should block a hook with a too long execution name", func() {
+			raw := map[string]interface{}{
+				"apiVersion": "dataplane.openstack.org/v1beta1",
+				"kind":       "OpenStackDataPlaneService",
+				"metadata": map[string]interface{}{
+					"name":      "a-service-with-a-long-name-to-test-the-hook-names",
+					"namespace": dataplaneServiceName.Namespace,
+				},
+				"spec": map[string]interface{}{
+					"postHooks": []map[string]interface{}{{
+						"name":     "smoke-test",
+						"playbook": "osp.edpm.smoke_test",
+					}},
+				},
+			}
+			unstructuredObj := &unstructured.Unstructured{Object: raw}
+			_, err := controllerutil.CreateOrPatch(
+				th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+			Expect(fmt.Sprintf("%s", err)).Should(ContainSubstring(
+				"must be no more than 63 characters"))
+		})
+	})
+
+	When("A service has a health check", func() {
+		It("Should block a health check with a too long execution name", func() {
+			raw := map[string]interface{}{
+				"apiVersion": "dataplane.openstack.org/v1beta1",
+				"kind":       "OpenStackDataPlaneService",
+				"metadata": map[string]interface{}{
+					"name":      "a-service-with-a-long-name-to-test-the-health-check-name",
+					"namespace": dataplaneServiceName.Namespace,
+				},
+				"spec": map[string]interface{}{
+					"healthCheck": map[string]interface{}{
+						"playbook": "osp.edpm.health_check",
+						"retries":  10,
+					},
+				},
+			}
+			unstructuredObj := &unstructured.Unstructured{Object: raw}
+			_, err := controllerutil.CreateOrPatch(
+				th.Ctx, th.K8sClient, unstructuredObj, func() error { return nil })
+			Expect(fmt.Sprintf("%s", err)).Should(ContainSubstring(
+				"must be no more than 63 characters"))
+		})
+	})
 })
@@ -18,6 +18,7 @@ package functional
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
 	"testing"
 	"time"
@@ -26,6 +27,7 @@ import (
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2" //revive:disable:dot-imports
 	. "github.com/onsi/gomega"    //revive:disable:dot-imports
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -41,8 +43,11 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 
+	certmgrv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	metal3v1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	dataplanev1 "github.com/openstack-k8s-operators/dataplane-operator/api/v1beta1"
 	"github.com/openstack-k8s-operators/dataplane-operator/controllers"
+	"github.com/openstack-k8s-operators/dataplane-operator/pkg/deployment"
 	infrav1 "github.com/openstack-k8s-operators/infra-operator/apis/network/v1beta1"
 	aee "github.com/openstack-k8s-operators/openstack-ansibleee-operator/api/v1beta1"
 	baremetalv1 "github.com/openstack-k8s-operators/openstack-baremetal-operator/api/v1beta1"
@@ -58,20 +63,23 @@ import (
 // http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
 
 var (
-	k8sClient client.Client // You'll be using this client in your tests.
-	testEnv   *envtest.Environment
-	ctx       context.Context
-	cancel    context.CancelFunc
-	logger    logr.Logger
-	th        *TestHelper
-	namespace string
+	k8sClient      client.Client // You'll be using this client in your tests.
+	testEnv        *envtest.Environment
+	ctx            context.Context
+	cancel         context.CancelFunc
+	logger         logr.Logger
+	th             *TestHelper
+	namespace      string
+	serviceCatalog *deployment.ServiceCatalog
 )
 
 const (
-	SecretName           = "test-secret"
-	MessageBusSecretName = "rabbitmq-secret"
-	ContainerImage       = "test://nova"
-	timeout              = 40 * time.Second
+	SecretName             = "test-secret"
+	MessageBusSecretName   = "rabbitmq-secret"
+	ContainerImage         = "test://nova"
+	BaremetalHostNamespace = "openshift-machine-api"
+	BaremetalHostPoolSize  = 10
+	timeout                = 40 * time.Second
 	// have maximum 100 retries before the timeout hits
 	interval = timeout / 100
 )
@@ -101,6 +109,8 @@ var _ = BeforeSuite(func() {
 	openstackCRDs, err := test.GetCRDDirFromModule(
 		"github.com/openstack-k8s-operators/openstack-operator/apis", gomod, "bases")
 	Expect(err).ShouldNot(HaveOccurred())
+	certmgrCRDs, err := test.GetOpenShiftCRDDir("cert-manager/v1", gomod)
+	Expect(err).ShouldNot(HaveOccurred())
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
@@ -110,6 +120,8 @@ var _ = BeforeSuite(func() {
 			baremetalCRDs,
 			infraCRDs,
 			openstackCRDs,
+			certmgrCRDs,
+			filepath.Join("crds"),
 		},
 		WebhookInstallOptions: envtest.WebhookInstallOptions{
 			Paths: []string{filepath.Join("..", "..", "config", "webhook")},
@@ -141,10 +153,14 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	err = baremetalv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = metal3v1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 	err = infrav1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 	err = openstackv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
+	err = certmgrv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
 	//+kubebuilder:scaffold:scheme
 
 	logger = ctrl.Log.WithName("---Test---")
@@ -155,6 +171,16 @@ var _ = BeforeSuite(func() {
 	th = NewTestHelper(ctx, k8sClient, timeout, interval, logger)
 	Expect(th).NotTo(BeNil())
 
+	// NOTE: Nothing consumes the BaremetalHosts in the test env, so a shared
+	// pool of available hosts is enough for the baremetal NodeSets
+	th.CreateNamespace(BaremetalHostNamespace)
+	for i := 0; i < BaremetalHostPoolSize; i++ {
+		CreateBaremetalHost(types.NamespacedName{
+			Name:      fmt.Sprintf("edpm-bmh-%d", i),
+			Namespace: BaremetalHostNamespace,
+		}, nil, nil)
+	}
+
 	// Start the controller-manager if goroutine
 	webhookInstallOptions := &testEnv.WebhookInstallOptions
 	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
@@ -183,10 +209,14 @@ var _ = BeforeSuite(func() {
 
 	kclient, err := kubernetes.NewForConfig(cfg)
 	Expect(err).ToNot(HaveOccurred(), "failed to create kclient")
+	serviceCatalog, err = deployment.LoadServiceCatalog("../../config/services")
+	Expect(err).ToNot(HaveOccurred())
+
 	err = (&controllers.OpenStackDataPlaneNodeSetReconciler{
-		Client:  k8sManager.GetClient(),
-		Scheme:  k8sManager.GetScheme(),
-		Kclient: kclient,
+		Client:         k8sManager.GetClient(),
+		Scheme:         k8sManager.GetScheme(),
+		Kclient:        kclient,
+		ServiceCatalog: serviceCatalog,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 